@@ -0,0 +1,315 @@
+// Package bootstrap scaffolds a goku.yaml for an existing repository by
+// finding its Dockerfiles and Helm charts.
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/timatooth/goku/config"
+	"gopkg.in/yaml.v2"
+)
+
+// Chart is a Helm chart found in the source tree
+type Chart struct {
+	Name string
+	// Directory of Chart.yaml relative to the root
+	Path string
+	// Values the chart templates use in image: fields, such as app1image
+	ImageValues []ImageValue
+	// Images proposed for the chart
+	Images []Image
+}
+
+// ImageValue is a chart value holding an image
+type ImageValue struct {
+	Name string
+	// config.ImageValueSplit when the chart uses Name.repository and Name.tag
+	Format string
+}
+
+// Image maps a Dockerfile to the chart value it should be deployed with
+type Image struct {
+	Name             string
+	ImageValueName   string
+	ImageValueFormat string
+	// Directory of the Dockerfile relative to the root
+	Path string
+}
+
+// Discovery is everything found below a root directory
+type Discovery struct {
+	Root   string
+	Charts []Chart
+	// Directories with a Dockerfile no chart value was matched to
+	Unmatched []string
+	// Chart values no Dockerfile was matched to, by chart name
+	UnmatchedValues map[string][]string
+}
+
+// directories which never hold sources worth watching
+var skipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// image: {{ .Values.app1image }} or image: "{{ .Values.image.repository }}:..."
+var imageValuePattern = regexp.MustCompile(`image:\s*["']?\{\{-?\s*\.Values\.([A-Za-z0-9_.]+)`)
+
+// Discover walks root for Dockerfiles and Helm charts (directories with a
+// Chart.yaml) and proposes which Dockerfile builds the image of each chart
+// value used in an image: field.
+func Discover(root string) (*Discovery, error) {
+	d := &Discovery{Root: root, UnmatchedValues: make(map[string][]string)}
+	var dockerDirs []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if path != root && (strings.HasPrefix(info.Name(), ".") || skipDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "Chart.yaml")); err == nil {
+				chart, err := readChart(path, rel)
+				if err != nil {
+					return err
+				}
+				d.Charts = append(d.Charts, chart)
+				// templates and subcharts are not image sources
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "Dockerfile" {
+			dockerDirs = append(dockerDirs, filepath.ToSlash(filepath.Dir(rel)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Charts) == 0 {
+		return nil, fmt.Errorf("no Helm charts (directories with a Chart.yaml) found below %s", root)
+	}
+
+	// chart names become release names so they must be unique
+	names := make(map[string]bool)
+	for i := range d.Charts {
+		chart := &d.Charts[i]
+		if names[chart.Name] {
+			chart.Name += "-" + imageName(chart.Path)
+		}
+		names[chart.Name] = true
+	}
+
+	d.match(dockerDirs, projectName(root))
+	return d, nil
+}
+
+// readChart reads the name of a chart and the values used in its image fields
+func readChart(dir string, rel string) (Chart, error) {
+	chart := Chart{Name: filepath.Base(dir), Path: rel}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return chart, err
+	}
+	var metadata struct {
+		Name string `yaml:"name"`
+	}
+	if err := yaml.Unmarshal(data, &metadata); err == nil && metadata.Name != "" {
+		chart.Name = metadata.Name
+	}
+
+	templates, err := filepath.Glob(filepath.Join(dir, "templates", "*"))
+	if err != nil {
+		return chart, err
+	}
+	sort.Strings(templates)
+	for _, template := range templates {
+		data, err := ioutil.ReadFile(template)
+		if err != nil {
+			continue
+		}
+		for _, match := range imageValuePattern.FindAllSubmatch(data, -1) {
+			value := ImageValue{Name: string(match[1])}
+			// image.repository and image.tag are both written by imageValueName image
+			for _, suffix := range []string{".repository", ".tag"} {
+				if strings.HasSuffix(value.Name, suffix) {
+					value = ImageValue{Name: strings.TrimSuffix(value.Name, suffix), Format: config.ImageValueSplit}
+				}
+			}
+			if !chart.hasImageValue(value.Name) {
+				chart.ImageValues = append(chart.ImageValues, value)
+			}
+		}
+	}
+	return chart, nil
+}
+
+func (c Chart) hasImageValue(name string) bool {
+	for _, value := range c.ImageValues {
+		if value.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// match proposes a Dockerfile for each chart image value by comparing the
+// value and directory names. Each Dockerfile is used at most once.
+func (d *Discovery) match(dockerDirs []string, project string) {
+	used := make(map[string]bool)
+	for i := range d.Charts {
+		chart := &d.Charts[i]
+		for _, value := range chart.ImageValues {
+			best, bestScore := "", 0
+			for _, dir := range dockerDirs {
+				if used[dir] {
+					continue
+				}
+				if score := matchScore(*chart, value.Name, dir); score > bestScore {
+					best, bestScore = dir, score
+				}
+			}
+			if best == "" {
+				d.UnmatchedValues[chart.Name] = append(d.UnmatchedValues[chart.Name], value.Name)
+				continue
+			}
+			used[best] = true
+			chart.Images = append(chart.Images, Image{
+				Name:             project + "/" + imageName(best),
+				ImageValueName:   value.Name,
+				ImageValueFormat: value.Format,
+				Path:             best,
+			})
+		}
+	}
+	for _, dir := range dockerDirs {
+		if !used[dir] {
+			d.Unmatched = append(d.Unmatched, dir)
+		}
+	}
+}
+
+// matchScore rates how likely the Dockerfile in dir builds the image of a chart value
+func matchScore(chart Chart, value string, dir string) int {
+	name := normalize(strings.NewReplacer("image", "", "repository", "", "tag", "").Replace(strings.ToLower(value)))
+	if name == "" {
+		// values like image name the image of the chart itself
+		name = normalize(chart.Name)
+	}
+	base := normalize(filepath.Base(dir))
+	score := 0
+	switch {
+	case name != "" && name == base:
+		score = 3
+	case name != "" && base != "" && (strings.Contains(name, base) || strings.Contains(base, name)):
+		score = 2
+	}
+	// Dockerfiles next to the chart belong to it, e.g. services/api/{chart,Dockerfile}
+	chartParent := filepath.ToSlash(filepath.Dir(chart.Path))
+	if chartParent != "." && (dir == chartParent || strings.HasPrefix(dir, chartParent+"/")) {
+		score++
+	}
+	return score
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+var nonRepositoryChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+func normalize(name string) string {
+	return nonAlphanumeric.ReplaceAllString(strings.ToLower(name), "")
+}
+
+// imageName converts a directory to a docker repository name component
+func imageName(dir string) string {
+	if dir == "." {
+		return "app"
+	}
+	name := strings.Trim(nonRepositoryChars.ReplaceAllString(strings.ToLower(dir), "-"), "-._")
+	if name == "" {
+		return "app"
+	}
+	return name
+}
+
+func projectName(root string) string {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "goku"
+	}
+	return imageName(filepath.Base(abs))
+}
+
+var gokuTemplate = template.Must(template.New("goku.yaml").Funcs(template.FuncMap{
+	"quote": quote,
+}).Parse(`# goku.yaml generated by goku bootstrap. Review the proposed image to chart
+# mappings, then run goku config --validate and goku watch.
+apiVersion: {{ .Version }}
+
+charts:
+{{- range .Discovery.Charts }}
+- name: {{ quote .Name }}
+  path: {{ quote .Path }}
+{{- if .Images }}
+  images:
+{{- range .Images }}
+  # built from {{ .Path }}/Dockerfile
+  - name: {{ quote .Name }}
+    # value used in an image: field of the chart templates
+    imageValueName: {{ quote .ImageValueName }}
+{{- if .ImageValueFormat }}
+    # the chart uses {{ .ImageValueName }}.repository and {{ .ImageValueName }}.tag
+    imageValueFormat: {{ .ImageValueFormat }}
+{{- end }}
+    # watched for changes and used as the docker build context
+    path: {{ quote .Path }}
+{{- end }}
+{{- end }}
+{{- range index $.Discovery.UnmatchedValues .Name }}
+  # TODO no Dockerfile found for the chart value {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Discovery.Unmatched }}
+
+# Dockerfiles not matched to a chart value:
+{{- range .Discovery.Unmatched }}
+#   {{ . }}/Dockerfile
+{{- end }}
+{{- end }}
+`))
+
+// Render writes a commented goku.yaml for a discovery
+func Render(d *Discovery) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gokuTemplate.Execute(&buf, struct {
+		Version   string
+		Discovery *Discovery
+	}{config.CurrentVersion, d})
+	return buf.Bytes(), err
+}
+
+// quote a string for YAML only when it needs it
+func quote(s string) string {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Sprintf("%q", s)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
@@ -0,0 +1,220 @@
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/timatooth/goku/config"
+	"gopkg.in/yaml.v2"
+)
+
+// writeFiles creates files with their content below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	root, err := ioutil.TempDir("", "goku-bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"services/api/Dockerfile":                      "FROM scratch\n",
+		"services/api/chart/Chart.yaml":                "name: api\n",
+		"services/api/chart/templates/deployment.yaml": "image: {{ .Values.apiImage }}\n",
+		"web/Dockerfile":                               "FROM scratch\n",
+		"deploy/web/Chart.yaml":                        "name: web\n",
+		"deploy/web/templates/deployment.yaml":         "image: \"{{ .Values.web.image }}\"\nimage: {{ .Values.sidecar.image }}\n",
+		"deploy/web/templates/job.yaml":                "image: {{ .Values.web.image }}\n",
+		"other/web/Chart.yaml":                         "name: web\n",
+		"worker/Dockerfile":                            "FROM scratch\n",
+		"node_modules/left-pad/Dockerfile":             "FROM scratch\n",
+		".git/Dockerfile":                              "FROM scratch\n",
+		"services/api/chart/templates/Dockerfile":      "FROM scratch\n",
+		"services/api/chart/charts/db/Chart.yaml":      "name: db\n",
+		"charts/worker/Chart.yaml":                     "name: worker\n",
+		"charts/worker/templates/deployment.yaml":      "image: {{ .Values.workerImage }}\n",
+		"tools/Dockerfile":                             "FROM scratch\n",
+	})
+
+	d, err := Discover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := projectName(root)
+	want := []Chart{
+		{Name: "worker", Path: "charts/worker", ImageValues: []ImageValue{{Name: "workerImage"}}, Images: []Image{
+			{Name: project + "/worker", ImageValueName: "workerImage", Path: "worker"},
+		}},
+		{Name: "web", Path: "deploy/web", ImageValues: []ImageValue{{Name: "web.image"}, {Name: "sidecar.image"}}, Images: []Image{
+			{Name: project + "/web", ImageValueName: "web.image", Path: "web"},
+		}},
+		{Name: "web-other-web", Path: "other/web"},
+		{Name: "api", Path: "services/api/chart", ImageValues: []ImageValue{{Name: "apiImage"}}, Images: []Image{
+			{Name: project + "/services-api", ImageValueName: "apiImage", Path: "services/api"},
+		}},
+	}
+	if !reflect.DeepEqual(d.Charts, want) {
+		t.Errorf("Discover() charts = %+v, want %+v", d.Charts, want)
+	}
+	if want := []string{"tools"}; !reflect.DeepEqual(d.Unmatched, want) {
+		t.Errorf("Discover() unmatched Dockerfiles = %v, want %v", d.Unmatched, want)
+	}
+	if want := map[string][]string{"web": {"sidecar.image"}}; !reflect.DeepEqual(d.UnmatchedValues, want) {
+		t.Errorf("Discover() unmatched values = %v, want %v", d.UnmatchedValues, want)
+	}
+}
+
+func TestDiscoverSplitFormat(t *testing.T) {
+	root, err := ioutil.TempDir("", "goku-bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"queue/Dockerfile":       "FROM scratch\n",
+		"queue/chart/Chart.yaml": "name: queue\n",
+		"queue/chart/templates/deployment.yaml": "image: \"{{ .Values.image.repository }}:{{ .Values.image.tag }}\"\n" +
+			"image: {{ .Values.metrics.image }}\n",
+	})
+
+	d, err := Discover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Chart{
+		{Name: "queue", Path: "queue/chart", ImageValues: []ImageValue{{Name: "image", Format: config.ImageValueSplit}, {Name: "metrics.image"}}, Images: []Image{
+			{Name: projectName(root) + "/queue", ImageValueName: "image", ImageValueFormat: config.ImageValueSplit, Path: "queue"},
+		}},
+	}
+	if !reflect.DeepEqual(d.Charts, want) {
+		t.Errorf("Discover() charts = %+v, want %+v", d.Charts, want)
+	}
+}
+
+func TestDiscoverWithoutCharts(t *testing.T) {
+	root, err := ioutil.TempDir("", "goku-bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{"Dockerfile": "FROM scratch\n"})
+
+	if _, err := Discover(root); err == nil {
+		t.Error("Discover() found charts in a directory without any")
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		chartPath string
+		value     string
+		dir       string
+		want      int
+	}{
+		{"charts/api", "apiImage", "api", 3},
+		{"charts/api", "api.image", "services/api", 3},
+		{"charts/api", "apiserverImage", "api", 2},
+		// a value named just image holds the image of the chart
+		{"charts/api", "image", "api", 3},
+		{"charts/api", "image.repository", "api", 3},
+		{"charts/web", "image", "api", 0},
+		{"charts/api", "webImage", "api", 0},
+		{"services/api/chart", "image", "services/api", 1},
+		{"services/api/chart", "apiImage", "services/api/cmd", 1},
+		{"services/api/chart", "apiImage", "services/api", 4},
+		{"services/api/chart", "apiImage", "services/apiv2", 2},
+	}
+	for _, test := range tests {
+		chart := Chart{Name: filepath.Base(test.chartPath), Path: test.chartPath}
+		if got := matchScore(chart, test.value, test.dir); got != test.want {
+			t.Errorf("matchScore(%s, %q, %s) = %d, want %d", test.chartPath, test.value, test.dir, got, test.want)
+		}
+	}
+}
+
+func TestImageName(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{".", "app"},
+		{"api", "api"},
+		{"services/API", "services-api"},
+		{"my_app.v2", "my_app.v2"},
+		{"-web-", "web"},
+		{"@@@", "app"},
+	}
+	for _, test := range tests {
+		if got := imageName(test.dir); got != test.want {
+			t.Errorf("imageName(%q) = %q, want %q", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	d := &Discovery{
+		Charts: []Chart{
+			{Name: "web", Path: "deploy/web", Images: []Image{
+				{Name: "project/web", ImageValueName: "web.image", Path: "web"},
+				{Name: "project/queue", ImageValueName: "queue.image", ImageValueFormat: config.ImageValueSplit, Path: "queue"},
+			}},
+			{Name: "yes", Path: "charts/yes"},
+		},
+		Unmatched:       []string{"worker"},
+		UnmatchedValues: map[string][]string{"web": {"sidecar.image"}},
+	}
+	data, err := Render(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TODO no Dockerfile found for the chart value sidecar.image",
+		"#   worker/Dockerfile",
+	} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("Render() is missing %q in:\n%s", line, data)
+		}
+	}
+
+	var rendered struct {
+		APIVersion string `yaml:"apiVersion"`
+		Charts     []struct {
+			Name   string `yaml:"name"`
+			Path   string `yaml:"path"`
+			Images []struct {
+				Name             string `yaml:"name"`
+				ImageValueName   string `yaml:"imageValueName"`
+				ImageValueFormat string `yaml:"imageValueFormat"`
+				Path             string `yaml:"path"`
+			} `yaml:"images"`
+		} `yaml:"charts"`
+	}
+	if err := yaml.UnmarshalStrict(data, &rendered); err != nil {
+		t.Fatalf("Render() wrote invalid YAML: %v\n%s", err, data)
+	}
+	if len(rendered.Charts) != 2 || rendered.Charts[1].Name != "yes" {
+		t.Fatalf("Render() charts = %+v", rendered.Charts)
+	}
+	image := rendered.Charts[0].Images[0]
+	if image.Name != "project/web" || image.ImageValueName != "web.image" || image.ImageValueFormat != "" || image.Path != "web" {
+		t.Errorf("Render() image = %+v", image)
+	}
+	split := rendered.Charts[0].Images[1]
+	if split.ImageValueName != "queue.image" || split.ImageValueFormat != config.ImageValueSplit {
+		t.Errorf("Render() image with the split format = %+v", split)
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/timatooth/goku/bootstrap"
+)
+
+var bootstrapForce bool
+var bootstrapDryRun bool
+
+var bootstrapCmd = &cobra.Command{
+	Use:   "bootstrap [directory]",
+	Short: "Scaffold a goku.yaml by finding Dockerfiles and Helm charts",
+	Long: `Walks the directory (default: current directory) for Dockerfiles and Helm
+charts, scans the chart templates for .Values used in image: fields and writes
+a commented goku.yaml mapping each Dockerfile to the chart value it builds.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+
+		discovery, err := bootstrap.Discover(root)
+		if err != nil {
+			return err
+		}
+		out, err := bootstrap.Render(discovery)
+		if err != nil {
+			return err
+		}
+		if bootstrapDryRun {
+			fmt.Print(string(out))
+			return nil
+		}
+
+		configPath := filepath.Join(root, "goku.yaml")
+		if _, err := os.Stat(configPath); err == nil && !bootstrapForce {
+			return fmt.Errorf("%s already exists, use --force to overwrite it or --dry-run to print the proposal", configPath)
+		}
+		if err := ioutil.WriteFile(configPath, out, 0644); err != nil {
+			return err
+		}
+		color.Green("Wrote %s with %d chart(s)", configPath, len(discovery.Charts))
+		if len(discovery.Unmatched) > 0 {
+			color.Yellow("%d Dockerfile(s) were not matched to a chart value, see the comments in %s", len(discovery.Unmatched), configPath)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bootstrapCmd)
+	bootstrapCmd.Flags().BoolVar(&bootstrapForce, "force", false, "Overwrite an existing goku.yaml")
+	bootstrapCmd.Flags().BoolVar(&bootstrapDryRun, "dry-run", false, "Print the proposed goku.yaml instead of writing it")
+}
@@ -2,32 +2,75 @@ package cmd
 
 import (
 	"fmt"
-	"log"
+	"os"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	GokuConfig "github.com/timatooth/goku/config"
+	"gopkg.in/yaml.v2"
 )
 
+var validateConfig bool
+var configProfile string
+
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Checks goku.yaml config structure",
-	Long:  `Dumps contests of GokuConfig struct to stdout`,
-	Run: func(cmd *cobra.Command, args []string) {
-		var gokuConfig *GokuConfig.GokuConfig
-		if len(args) < 1 {
-			// look for goku.yaml in current dir
-			log.Println("Looking for goku.yaml file in current directory")
-			gokuConfig = GokuConfig.ReadConfig("goku.yaml")
-		} else {
-			log.Printf("Looking for goku.yaml file in %s\n", args[0])
-			gokuConfig = GokuConfig.ReadConfig(args[0])
+	Long: `Dumps the goku.yaml config, merged with the files it includes, to stdout.
+With --profile the named profile is applied first.
+
+Every problem in goku.yaml is reported on stderr with its line and column:
+unknown keys, missing required fields, chart, image, context and Dockerfile
+paths which do not exist below the goku.yaml directory and build targets which
+are not a stage of their Dockerfile. With --validate the config is only
+checked, exiting non-zero if it has problems.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gokuConfig, err := loadConfig(args)
+		if err != nil {
+			return err
+		}
+		if !validateConfig {
+			profiled, err := gokuConfig.WithProfile(configProfile)
+			if err != nil {
+				return err
+			}
+			merged := *profiled
+			merged.Include = nil
+			if configProfile != "" {
+				fmt.Printf("# goku.yaml with profile %q applied\n", configProfile)
+				merged.Profiles = nil
+			}
+			out, err := yaml.Marshal(&merged)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(out))
+			if err := gokuConfig.Validate(); err != nil {
+				fmt.Fprintln(os.Stderr, color.RedString(err.Error()))
+				if errs, ok := err.(GokuConfig.ValidationErrors); ok {
+					fmt.Fprintln(os.Stderr, color.YellowString("goku.yaml has %d problem(s)", len(errs)))
+				}
+			}
+			return nil
+		}
+
+		if err := gokuConfig.Validate(); err != nil {
+			errs, ok := err.(GokuConfig.ValidationErrors)
+			if !ok {
+				return err
+			}
+			color.Red(err.Error())
+			return fmt.Errorf("goku.yaml has %d problem(s)", len(errs))
 		}
-		fmt.Printf("%+v\n", gokuConfig)
+		color.Green("goku.yaml is valid")
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(configCmd)
+	configCmd.Flags().BoolVar(&validateConfig, "validate", false, "Validate goku.yaml and exit non-zero if it has problems")
+	configCmd.Flags().StringVar(&configProfile, "profile", "", "Print the config with this profile applied")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/timatooth/goku/engine"
+	"github.com/timatooth/goku/hosts"
+)
+
+var hostsFile string
+
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Point the hosts in goku.yaml at the minikube IP",
+	Long: `Writes a clearly marked block to the hosts file mapping every entry of the
+hosts: list in goku.yaml to the current minikube ip. Other entries in the hosts
+file are kept. goku watch keeps the block up to date while it runs.
+
+Writing /etc/hosts usually requires sudo.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gokuConfig, err := loadConfig(args)
+		if err != nil {
+			return err
+		}
+		if len(gokuConfig.Hosts) == 0 {
+			return fmt.Errorf("no hosts: listed in goku.yaml")
+		}
+
+		ip, err := engine.MinikubeIP()
+		if err != nil {
+			return err
+		}
+		changed, err := hosts.Update(hostsFile, ip, gokuConfig.Hosts)
+		if err != nil {
+			return err
+		}
+		if changed {
+			color.Green("Pointed %d host(s) at %s in %s", len(gokuConfig.Hosts), ip, hostsFile)
+		} else {
+			color.Green("%s is up to date", hostsFile)
+		}
+		return nil
+	},
+}
+
+var hostsCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the goku block from the hosts file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, err := hosts.Clean(hostsFile)
+		if err != nil {
+			return err
+		}
+		if removed {
+			color.Green("Removed goku hosts from %s", hostsFile)
+		} else {
+			color.Green("%s has no goku hosts", hostsFile)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hostsCmd)
+	hostsCmd.AddCommand(hostsCleanCmd)
+	hostsCmd.PersistentFlags().StringVar(&hostsFile, "hosts-file", hosts.DefaultPath(), "hosts file to manage")
+}
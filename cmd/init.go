@@ -13,7 +13,6 @@ import (
 	"github.com/fatih/color"
 	"github.com/mholt/archiver"
 	"github.com/spf13/cobra"
-	GokuConfig "github.com/timatooth/goku/config"
 )
 
 // initCmd represents the init command
@@ -30,14 +29,9 @@ var initCmd = &cobra.Command{
 	Your should add ~/.goku/bin to your $PATH
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var gokuConfig *GokuConfig.GokuConfig
-		if len(args) < 1 {
-			// look for goku.yaml in current dir
-			log.Println("Looking for goku.yaml file in current directory")
-			gokuConfig = GokuConfig.ReadConfig("goku.yaml")
-		} else {
-			log.Printf("Looking for goku.yaml file in %s\n", args[0])
-			gokuConfig = GokuConfig.ReadConfig(args[0])
+		gokuConfig, err := loadConfig(args)
+		if err != nil {
+			log.Fatal(err)
 		}
 
 		// get home dir
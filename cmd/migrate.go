@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	GokuConfig "github.com/timatooth/goku/config"
+)
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade goku.yaml to the current config format",
+	Long: `Rewrites goku.yaml in place in the current config format (` + GokuConfig.CurrentVersion + `).
+Comments and formatting are kept. Files included by goku.yaml are not changed,
+run migrate on each of them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gokuPath, err := configPath(args)
+		if err != nil {
+			return err
+		}
+		log.Printf("Migrating %s\n", gokuPath)
+
+		info, err := os.Stat(gokuPath)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(gokuPath)
+		if err != nil {
+			return err
+		}
+		migrated, version, err := GokuConfig.Migrate(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", gokuPath, err)
+		}
+		if version == GokuConfig.CurrentVersion {
+			color.Green("%s is already %s", gokuPath, GokuConfig.CurrentVersion)
+			return nil
+		}
+
+		// write next to goku.yaml and rename so it is never left half written
+		tmp, err := ioutil.TempFile(filepath.Dir(gokuPath), ".goku.yaml")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(migrated); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), gokuPath); err != nil {
+			return err
+		}
+		color.Green("Migrated %s to %s", gokuPath, GokuConfig.CurrentVersion)
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configMigrateCmd)
+}
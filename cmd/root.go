@@ -2,11 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	GokuConfig "github.com/timatooth/goku/config"
 )
 
 var cfgFile string
@@ -17,6 +17,9 @@ var rootCmd = &cobra.Command{
 	Short: "Watches files to deploy on Kubernetes instantly with CTRL-S using Helm.",
 	Long: `Goku is a development tool for setting up local Kubernetes from scratch and
 	automated watch deployment on save.`,
+	// errors are printed once by Execute
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
@@ -32,40 +35,36 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
-	//rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.goku.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "f", "", "goku.yaml file (default is goku.yaml in the current or nearest parent directory)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
+// configPath resolves the goku.yaml every command uses: the --config flag,
+// then the deprecated positional argument, then a search of the current and
+// parent directories.
+func configPath(args []string) (string, error) {
 	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		// Search config in home directory with name ".snakes" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".snakes")
+		return cfgFile, nil
 	}
+	if len(args) > 0 {
+		log.Printf("Passing goku.yaml as an argument is deprecated, use --config %s", args[0])
+		return args[0], nil
+	}
+	return GokuConfig.Find(".")
+}
 
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+// loadConfig reads the goku.yaml resolved by configPath
+func loadConfig(args []string) (*GokuConfig.GokuConfig, error) {
+	path, err := configPath(args)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("Using %s\n", path)
+	return GokuConfig.ReadConfig(path)
 }
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	GokuConfig "github.com/timatooth/goku/config"
+)
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of goku.yaml",
+	Long: `Prints a JSON Schema generated from the goku.yaml config types of this goku
+binary. Point your editor's YAML language server at it for autocompletion and
+linting. The schema rejects the same unknown keys and missing fields as
+goku config --validate.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema := GokuConfig.JSONSchema()
+		schema["$comment"] = "Generated by Goku " + version
+
+		out, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configSchemaCmd)
+}
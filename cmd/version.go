@@ -6,6 +6,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// version of the goku binary, also stamped into the goku.yaml JSON Schema
+const version = "v1.0.1"
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
@@ -15,6 +18,6 @@ var versionCmd = &cobra.Command{
 	Short: "Print the version number of Goku",
 	Long:  `All software has versions. This is Gokus's`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Goku v1.0.1")
+		fmt.Println("Goku " + version)
 	},
 }
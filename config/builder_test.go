@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckBuilders(t *testing.T) {
+	tests := []struct {
+		name  string
+		image Image
+		want  []string
+	}{
+		{name: "default", image: Image{}},
+		{name: "buildx", image: Image{Builder: BuilderBuildx}},
+		{name: "command", image: Image{Builder: BuilderCommand, Command: "make image"}},
+		{name: "go", image: Image{Builder: BuilderGo, Go: GoBuild{Main: "./cmd/app"}}},
+		{
+			name:  "go without the go builder",
+			image: Image{Builder: BuilderCLI, Go: GoBuild{Cgo: true}},
+			want:  []string{`charts[0].images[0].go: go is only used with builder "go"`},
+		},
+		{
+			name:  "unknown",
+			image: Image{Builder: "kaniko"},
+			want:  []string{`charts[0].images[0].builder: unknown value "kaniko", must be one of ` + "docker, cli, buildx, command, go"},
+		},
+		{
+			name:  "command missing",
+			image: Image{Builder: BuilderCommand},
+			want:  []string{`charts[0].images[0].command: missing required field "command" for builder "command"`},
+		},
+		{
+			name:  "command without the command builder",
+			image: Image{Command: "make image"},
+			want:  []string{`charts[0].images[0].command: command is only run with builder "command"`},
+		},
+	}
+	for _, test := range tests {
+		v := &validator{}
+		v.checkBuilders([]Chart{{Name: "app", Images: []Image{test.image}}})
+		var got []string
+		for _, err := range v.errs {
+			got = append(got, err.Field+": "+err.Message)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: checkBuilders() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
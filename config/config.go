@@ -1,56 +1,243 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
+	"reflect"
 
 	"gopkg.in/yaml.v2"
 )
 
 // goku.yaml structure
 type GokuConfig struct {
-	// Helm charts
-	Charts []struct {
-		// Vanity name of the chart
-		Name string `yaml:"name"`
-		// Location of the chart relative to the goku.yaml file BaseDir
-		Path string `yaml:"path"`
-		// Map image, name, helm template value names for overriding
-		Images []struct {
-			// The value name which must exist in the helm chart templates
-			ImageValueName string `yaml:"imageValueName"`
-			Name           string `yaml:"name"`
-			// Path for Goku to watch for changes. Used as the default docker ContextPath
-			Path string `yaml:"path"`
-			// Optional extra tags to apply to the image
-			Tags []string `yaml:"tags"`
-			// Optionl set a different Docker build context Path from the watch Path.
-			ContextPath string `yaml:"contextPath"`
-			// Optional custom path to Dockerfile. Must be below the ContextPath
-			Dockerfile string `yaml:"dockerfile"`
-		} `yaml:"images"`
-	} `yaml:"charts"`
-	Tools map[string]map[string]string `yaml:"tools"`
+	// Version of the goku.yaml format. Files without it are in the deprecated legacy format
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	// Other goku.yaml files or glob patterns, relative to this file, whose charts are merged into this config
+	Include []string `yaml:"include,omitempty"`
+	// Helm charts to deploy with the images goku builds for them
+	Charts []Chart `yaml:"charts,omitempty"`
+	// Overlays of charts, images and values selected with --profile
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	// Options for building every image, read from the top goku.yaml only
+	Build BuildConfig `yaml:"build,omitempty"`
+	// Options for watching the files of every image, read from the top goku.yaml only
+	Watch WatchConfig `yaml:"watch,omitempty"`
+	// Download URLs of tools by name and OS, installed by goku init
+	Tools map[string]map[string]string `yaml:"tools,omitempty"`
+	// Host names to point at the cluster IP in /etc/hosts
+	Hosts []string `yaml:"hosts,omitempty"`
 	// The base path relative to goku.yaml where all paths are built from
-	BaseDir string
+	BaseDir string `yaml:"-"`
+
+	// goku.yaml file the config was read from
+	file string
+	// profile laid over the config with WithProfile
+	profile string
+	// where each key was written in the goku.yaml file
+	source *sourceIndex
+	// every goku.yaml file merged into this config, as written
+	files []*GokuConfig
+	// where each of the merged Charts was defined
+	origins []chartOrigin
 }
 
-// Configuration read from goku.yaml file
-func ReadConfig(configPath string) *GokuConfig {
-	configData, err := ioutil.ReadFile(configPath)
+// BuildConfig holds the options for building every image
+type BuildConfig struct {
+	// Gzip the build context sent to docker, which helps with remote docker daemons
+	CompressContext bool `yaml:"compressContext,omitempty"`
+	// Sort the build context and clear file times, owners and permissions
+	// other than executable, so the same files always give the same context
+	// and SHA-256 digest
+	ReproducibleContext bool `yaml:"reproducibleContext,omitempty"`
+	// How images are tagged: timestamp (the default), gitCommit, contentHash or
+	// a Go template such as {{.GitCommit}}-{{.Timestamp}}
+	TagPolicy string `yaml:"tagPolicy,omitempty"`
+	// How many images are built at the same time, 2 by default
+	Concurrency int `yaml:"concurrency,omitempty"`
+}
+
+// WatchConfig holds the options for watching the files of every image
+type WatchConfig struct {
+	// How long to wait after a change for further changes before rebuilding,
+	// such as 500ms. Bursts of changes give one rebuild. 300ms by default
+	Debounce string `yaml:"debounce,omitempty"`
+	// Ignore changes to the files ignored by the .gitignore files below the
+	// path of each image
+	Gitignore bool `yaml:"gitignore,omitempty"`
+	// Ignore changes to the files ignored by the .dockerignore files below the
+	// path of each image. The .dockerignore of the build context always is
+	Dockerignore bool `yaml:"dockerignore,omitempty"`
+}
+
+// Helm chart deployed by goku
+type Chart struct {
+	// Vanity name of the chart
+	Name string `yaml:"name"`
+	// Location of the chart relative to the goku.yaml file BaseDir
+	Path string `yaml:"path"`
+	// Map image, name, helm template value names for overriding
+	Images []Image `yaml:"images,omitempty"`
+	// Helm values files relative to BaseDir, each merged over the chart's own
+	// values.yaml and the files before it
+	ValuesFiles []string `yaml:"valuesFiles,omitempty"`
+	// Extra Helm values merged over the ValuesFiles. The images goku builds
+	// are set over these
+	Values map[string]interface{} `yaml:"values,omitempty"`
+	// Names of charts which must be deployed and ready before this chart is deployed
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+	// Redeploy the charts which depend on this chart whenever it is redeployed
+	RedeployDependents bool `yaml:"redeployDependents,omitempty"`
+}
+
+// Docker image built by goku and deployed in a chart
+type Image struct {
+	// The Helm value path goku sets to the built image, such as image or
+	// containers[0].image. Periods in a key are escaped like helm --set: a\.b
+	ImageValueName string `yaml:"imageValueName"`
+	// How the image is written to ImageValueName: full (the default) sets it to
+	// repository:tag, split sets its repository and tag values and id sets it
+	// to the local image ID, which is not a pullable reference
+	ImageValueFormat string `yaml:"imageValueFormat,omitempty"`
+	// Docker image name (repository) to build and tag
+	Name string `yaml:"name"`
+	// Path for Goku to watch for changes. Used as the default docker ContextPath
+	Path string `yaml:"path"`
+	// Optional extra tags to apply to the image
+	Tags []string `yaml:"tags,omitempty"`
+	// Optionally set a different Docker build context Path from the watch Path.
+	ContextPath string `yaml:"contextPath,omitempty"`
+	// Optional custom path to Dockerfile. Must be below the ContextPath
+	Dockerfile string `yaml:"dockerfile,omitempty"`
+	// Build-time variables for the Dockerfile ARG instructions
+	BuildArgs map[string]string `yaml:"buildArgs,omitempty"`
+	// Stage of a multi-stage Dockerfile to build
+	Target string `yaml:"target,omitempty"`
+	// Labels to set on the image
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Networking mode for the RUN instructions, such as host or none
+	Network string `yaml:"network,omitempty"`
+	// Build without using the layer cache
+	NoCache bool `yaml:"noCache,omitempty"`
+	// Tag policy for this image instead of the build tagPolicy
+	TagPolicy string `yaml:"tagPolicy,omitempty"`
+	// How the image is built: docker (the docker API, the default), cli (docker
+	// build), buildx (docker buildx build), command or go
+	Builder string `yaml:"builder,omitempty"`
+	// Shell command building the image for the command builder, run in the
+	// build context with $IMAGE set to the name:tag to build and $TAG to the tag
+	Command string `yaml:"command,omitempty"`
+	// Go main package to compile on the host for the go builder, which needs
+	// no Dockerfile. The build context is the directory go build runs in
+	Go GoBuild `yaml:"go,omitempty"`
+	// Debounce window of this image instead of the watch debounce
+	Debounce string `yaml:"debounce,omitempty"`
+	// Glob patterns of files below Path whose changes don't trigger rebuilds,
+	// such as *.pyc or reports/**. Patterns without a / match names at any depth
+	Ignore []string `yaml:"ignore,omitempty"`
+}
+
+// Ways an image can be written to its ImageValueName
+const (
+	ImageValueFull  = "full"
+	ImageValueSplit = "split"
+	ImageValueID    = "id"
+)
+
+// Builders of images
+const (
+	BuilderDocker  = "docker"
+	BuilderCLI     = "cli"
+	BuilderBuildx  = "buildx"
+	BuilderCommand = "command"
+	BuilderGo      = "go"
+)
+
+// Tag policies of images, other than templates
+const (
+	// Unix time with nanoseconds
+	TagTimestamp = "timestamp"
+	// Short git commit SHA of the build context, with a -dirty suffix and the
+	// start of the content hash when it has uncommitted changes
+	TagGitCommit = "gitCommit"
+	// Start of the SHA-256 hash of the build context and build options
+	TagContentHash = "contentHash"
+)
+
+// GoBuild is how the go builder compiles an image's binary
+type GoBuild struct {
+	// Main package to build, such as ./cmd/app. Defaults to the build context
+	Main string `yaml:"main,omitempty"`
+	// Image the binary is added to as /app, scratch by default
+	BaseImage string `yaml:"baseImage,omitempty"`
+	// Extra go build flags, such as -tags or -ldflags
+	Flags []string `yaml:"flags,omitempty"`
+	// GOARCH to compile for, the architecture goku runs on by default
+	Arch string `yaml:"arch,omitempty"`
+	// Compile with cgo, which needs a C cross compiler for linux
+	Cgo bool `yaml:"cgo,omitempty"`
+}
+
+// Profile is an overlay on top of goku.yaml, selected with --profile
+type Profile struct {
+	// Charts to change, matched by name. Images are matched by name, values
+	// are merged and other fields replace the original when set. Charts which
+	// don't match are added.
+	Charts []Chart `yaml:"charts,omitempty"`
+}
+
+// Configuration read from goku.yaml file and the files it includes. Included
+// files which can't be read or parsed and charts defined in more than one file
+// are returned as ValidationErrors.
+func ReadConfig(configPath string) (*GokuConfig, error) {
+	gokuConfig, err := readConfigFile(configPath)
 	if err != nil {
-		panic("Could not read: " + configPath)
+		return nil, err
 	}
-	gokuConfig := GokuConfig{}
-	err = yaml.Unmarshal(configData, &gokuConfig)
+	return mergeIncludes(gokuConfig)
+}
 
+// readConfigFile reads a single goku.yaml file without its includes
+func readConfigFile(configPath string) (*GokuConfig, error) {
+	configData, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read goku config: %v", err)
+	}
+	migrated, version, err := Migrate(configData)
 	if err != nil {
-		log.Fatalf("yaml error: %v", err)
+		return nil, fmt.Errorf("%s: %v", configPath, err)
+	}
+	if version != CurrentVersion {
+		log.Printf("%s: %s is deprecated, run goku config migrate to upgrade it to %s", configPath, versionName(version), CurrentVersion)
+	}
+
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal(migrated, &raw); err != nil {
+		return nil, fmt.Errorf("%s: yaml error: %v", configPath, err)
+	}
+	interpolated, unset := interpolate(raw, os.LookupEnv)
+	for _, name := range unset {
+		log.Printf("%s: environment variable %s is not set, using an empty value", configPath, name)
+	}
+	if !reflect.DeepEqual(interpolated, raw) {
+		// lines of yaml errors refer to the file as written unless values changed
+		if migrated, err = yaml.Marshal(interpolated); err != nil {
+			return nil, fmt.Errorf("%s: %v", configPath, err)
+		}
+	}
+
+	gokuConfig := GokuConfig{}
+	if err := yaml.Unmarshal(migrated, &gokuConfig); err != nil {
+		return nil, fmt.Errorf("%s: yaml error: %v", configPath, err)
 	}
 
 	//set the BaseDir so every path is relative to the Gokufile
 	gokuConfig.BaseDir = path.Dir(configPath)
+	gokuConfig.file = configPath
+	// positions refer to the file as written, not as migrated
+	gokuConfig.source = newSourceIndex(configData)
 
-	return &gokuConfig
+	return &gokuConfig, nil
 }
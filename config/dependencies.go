@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dependents maps each chart name to the names of the charts which depend on it
+func (c *GokuConfig) Dependents() map[string][]string {
+	dependents := make(map[string][]string)
+	for _, chart := range c.Charts {
+		for _, dependency := range chart.DependsOn {
+			dependents[dependency] = append(dependents[dependency], chart.Name)
+		}
+	}
+	return dependents
+}
+
+// validateDependencies reports dependsOn entries naming unknown charts and
+// dependency cycles, which would leave charts waiting forever
+func (c *GokuConfig) validateDependencies() ValidationErrors {
+	var errs ValidationErrors
+	index := make(map[string]int, len(c.Charts))
+	for i, chart := range c.Charts {
+		index[chart.Name] = i
+	}
+
+	for i, chart := range c.Charts {
+		for j, dependency := range chart.DependsOn {
+			field := fmt.Sprintf(".dependsOn[%d]", j)
+			switch _, ok := index[dependency]; {
+			case dependency == chart.Name:
+				errs = append(errs, c.chartError(i, field, "chart %q depends on itself", chart.Name))
+			case !ok:
+				errs = append(errs, c.chartError(i, field, "depends on unknown chart %q", dependency))
+			}
+		}
+	}
+
+	// depth first search, a chart seen again while still being visited closes a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(c.Charts))
+	var path []string
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		path = append(path, c.Charts[i].Name)
+		for _, dependency := range c.Charts[i].DependsOn {
+			j, ok := index[dependency]
+			if !ok || j == i {
+				continue
+			}
+			switch state[j] {
+			case visiting:
+				start := 0
+				for k, name := range path {
+					if name == dependency {
+						start = k
+					}
+				}
+				cycle := append(append([]string(nil), path[start:]...), dependency)
+				errs = append(errs, c.chartError(i, ".dependsOn", "dependency cycle %s", strings.Join(cycle, " -> ")))
+			case unvisited:
+				visit(j)
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+	}
+	for i := range c.Charts {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return errs
+}
+
+// chartError locates a problem with a merged chart in the file it was defined in
+func (c *GokuConfig) chartError(i int, field string, format string, args ...interface{}) ValidationError {
+	if i >= len(c.origins) {
+		field = fmt.Sprintf("charts[%d]%s", i, field)
+		return ValidationError{File: c.file, Position: c.source.position(field), Field: field, Message: fmt.Sprintf(format, args...)}
+	}
+	origin := c.origins[i]
+	field = origin.field + field
+	return ValidationError{
+		File:     origin.file.file,
+		Position: origin.file.source.position(field),
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
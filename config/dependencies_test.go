@@ -0,0 +1,99 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependents(t *testing.T) {
+	c := &GokuConfig{Charts: []Chart{
+		{Name: "web", DependsOn: []string{"api", "auth"}},
+		{Name: "api", DependsOn: []string{"db"}},
+		{Name: "auth", DependsOn: []string{"db"}},
+		{Name: "db"},
+	}}
+	want := map[string][]string{"api": {"web"}, "auth": {"web"}, "db": {"api", "auth"}}
+	if got := c.Dependents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Dependents() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		charts []Chart
+		want   []string
+	}{
+		{
+			name: "valid",
+			charts: []Chart{
+				{Name: "web", DependsOn: []string{"api", "db"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "db"},
+			},
+		},
+		{
+			name:   "itself",
+			charts: []Chart{{Name: "web", DependsOn: []string{"web"}}},
+			want:   []string{`charts[0].dependsOn[0]: chart "web" depends on itself`},
+		},
+		{
+			name:   "unknown",
+			charts: []Chart{{Name: "web", DependsOn: []string{"api"}}},
+			want:   []string{`charts[0].dependsOn[0]: depends on unknown chart "api"`},
+		},
+		{
+			name: "cycle",
+			charts: []Chart{
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "db", DependsOn: []string{"web"}},
+			},
+			want: []string{"charts[2].dependsOn: dependency cycle web -> api -> db -> web"},
+		},
+		{
+			name: "cycle below a chart",
+			charts: []Chart{
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "db", DependsOn: []string{"api"}},
+			},
+			want: []string{"charts[2].dependsOn: dependency cycle api -> db -> api"},
+		},
+	}
+	for _, test := range tests {
+		c := &GokuConfig{Charts: test.charts}
+		var got []string
+		for _, err := range c.validateDependencies() {
+			got = append(got, err.Field+": "+err.Message)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: validateDependencies() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateProfileDependencies(t *testing.T) {
+	c := &GokuConfig{
+		Charts: []Chart{
+			{Name: "web", DependsOn: []string{"api"}},
+			{Name: "api", DependsOn: []string{"missing"}},
+		},
+		Profiles: map[string]Profile{
+			"worker": {Charts: []Chart{{Name: "worker", DependsOn: []string{"queue"}}}},
+			"cycle":  {Charts: []Chart{{Name: "api", DependsOn: []string{"web"}}}},
+		},
+	}
+	var got []string
+	for _, err := range c.validateProfiles() {
+		got = append(got, err.Field+": "+err.Message)
+	}
+	// the unknown dependency of api without a profile is left to Validate
+	want := []string{
+		`charts[1].dependsOn: with profile "cycle": dependency cycle web -> api -> web`,
+		`charts[2].dependsOn[0]: with profile "worker": depends on unknown chart "queue"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validateProfiles() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Code generated by gen_descriptions.go; DO NOT EDIT.
+
+package config
+
+// fieldDescriptions are the doc comments of the config struct fields
+var fieldDescriptions = map[string]string{
+	"BuildConfig.CompressContext":     "Gzip the build context sent to docker, which helps with remote docker daemons",
+	"BuildConfig.Concurrency":         "How many images are built at the same time, 2 by default",
+	"BuildConfig.ReproducibleContext": "Sort the build context and clear file times, owners and permissions other than executable, so the same files always give the same context and SHA-256 digest",
+	"BuildConfig.TagPolicy":           "How images are tagged: timestamp (the default), gitCommit, contentHash or a Go template such as {{.GitCommit}}-{{.Timestamp}}",
+	"Chart.DependsOn":                 "Names of charts which must be deployed and ready before this chart is deployed",
+	"Chart.Images":                    "Map image, name, helm template value names for overriding",
+	"Chart.Name":                      "Vanity name of the chart",
+	"Chart.Path":                      "Location of the chart relative to the goku.yaml file BaseDir",
+	"Chart.RedeployDependents":        "Redeploy the charts which depend on this chart whenever it is redeployed",
+	"Chart.Values":                    "Extra Helm values merged over the ValuesFiles. The images goku builds are set over these",
+	"Chart.ValuesFiles":               "Helm values files relative to BaseDir, each merged over the chart's own values.yaml and the files before it",
+	"GoBuild.Arch":                    "GOARCH to compile for, the architecture goku runs on by default",
+	"GoBuild.BaseImage":               "Image the binary is added to as /app, scratch by default",
+	"GoBuild.Cgo":                     "Compile with cgo, which needs a C cross compiler for linux",
+	"GoBuild.Flags":                   "Extra go build flags, such as -tags or -ldflags",
+	"GoBuild.Main":                    "Main package to build, such as ./cmd/app. Defaults to the build context",
+	"GokuConfig.APIVersion":           "Version of the goku.yaml format. Files without it are in the deprecated legacy format",
+	"GokuConfig.BaseDir":              "The base path relative to goku.yaml where all paths are built from",
+	"GokuConfig.Build":                "Options for building every image, read from the top goku.yaml only",
+	"GokuConfig.Charts":               "Helm charts to deploy with the images goku builds for them",
+	"GokuConfig.Hosts":                "Host names to point at the cluster IP in /etc/hosts",
+	"GokuConfig.Include":              "Other goku.yaml files or glob patterns, relative to this file, whose charts are merged into this config",
+	"GokuConfig.Profiles":             "Overlays of charts, images and values selected with --profile",
+	"GokuConfig.Tools":                "Download URLs of tools by name and OS, installed by goku init",
+	"GokuConfig.Watch":                "Options for watching the files of every image, read from the top goku.yaml only",
+	"Image.BuildArgs":                 "Build-time variables for the Dockerfile ARG instructions",
+	"Image.Builder":                   "How the image is built: docker (the docker API, the default), cli (docker build), buildx (docker buildx build), command or go",
+	"Image.Command":                   "Shell command building the image for the command builder, run in the build context with $IMAGE set to the name:tag to build and $TAG to the tag",
+	"Image.ContextPath":               "Optionally set a different Docker build context Path from the watch Path.",
+	"Image.Debounce":                  "Debounce window of this image instead of the watch debounce",
+	"Image.Dockerfile":                "Optional custom path to Dockerfile. Must be below the ContextPath",
+	"Image.Go":                        "Go main package to compile on the host for the go builder, which needs no Dockerfile. The build context is the directory go build runs in",
+	"Image.Ignore":                    "Glob patterns of files below Path whose changes don't trigger rebuilds, such as *.pyc or reports/**. Patterns without a / match names at any depth",
+	"Image.ImageValueFormat":          "How the image is written to ImageValueName: full (the default) sets it to repository:tag, split sets its repository and tag values and id sets it to the local image ID, which is not a pullable reference",
+	"Image.ImageValueName":            "The Helm value path goku sets to the built image, such as image or containers[0].image. Periods in a key are escaped like helm --set: a\\.b",
+	"Image.Labels":                    "Labels to set on the image",
+	"Image.Name":                      "Docker image name (repository) to build and tag",
+	"Image.Network":                   "Networking mode for the RUN instructions, such as host or none",
+	"Image.NoCache":                   "Build without using the layer cache",
+	"Image.Path":                      "Path for Goku to watch for changes. Used as the default docker ContextPath",
+	"Image.TagPolicy":                 "Tag policy for this image instead of the build tagPolicy",
+	"Image.Tags":                      "Optional extra tags to apply to the image",
+	"Image.Target":                    "Stage of a multi-stage Dockerfile to build",
+	"Profile.Charts":                  "Charts to change, matched by name. Images are matched by name, values are merged and other fields replace the original when set. Charts which don't match are added.",
+	"WatchConfig.Debounce":            "How long to wait after a change for further changes before rebuilding, such as 500ms. Bursts of changes give one rebuild. 300ms by default",
+	"WatchConfig.Dockerignore":        "Ignore changes to the files ignored by the .dockerignore files below the path of each image. The .dockerignore of the build context always is",
+	"WatchConfig.Gitignore":           "Ignore changes to the files ignored by the .gitignore files below the path of each image",
+}
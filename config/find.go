@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileName of the goku config searched for by Find
+const FileName = "goku.yaml"
+
+// Find looks for goku.yaml in dir and then each of its parent directories,
+// the way git finds .git. The path found is relative to dir when possible.
+func Find(dir string) (string, error) {
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for current := start; ; {
+		candidate := filepath.Join(current, FileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			if rel, err := filepath.Rel(start, candidate); err == nil {
+				return filepath.Join(dir, rel), nil
+			}
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", fmt.Errorf("%s not found in %s or any parent directory", FileName, start)
+		}
+		current = parent
+	}
+}
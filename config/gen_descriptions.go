@@ -0,0 +1,124 @@
+//go:build ignore
+// +build ignore
+
+// Generates descriptions.go from the doc comments of the goku.yaml config
+// types so they can be used in the JSON Schema. Run with go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+const output = "descriptions.go"
+
+// named structs already collected
+var visited = map[string]bool{"GokuConfig": true}
+
+func main() {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, ".", func(info os.FileInfo) bool {
+		name := info.Name()
+		return name != output && !strings.HasSuffix(name, "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	structs := make(map[string]*ast.StructType)
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+						structs[typeSpec.Name.Name] = structType
+					}
+				}
+			}
+		}
+	}
+
+	descriptions := make(map[string]string)
+	collect(descriptions, structs, "GokuConfig", structs["GokuConfig"])
+
+	keys := make([]string, 0, len(descriptions))
+	for key := range descriptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen_descriptions.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package config\n\n")
+	buf.WriteString("// fieldDescriptions are the doc comments of the config struct fields\n")
+	buf.WriteString("var fieldDescriptions = map[string]string{\n")
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "\t%q: %q,\n", key, descriptions[key])
+	}
+	buf.WriteString("}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(output, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// collect the doc comment of every exported field, descending into the
+// anonymous and named structs of the package the fields use
+func collect(descriptions map[string]string, structs map[string]*ast.StructType, prefix string, structType *ast.StructType) {
+	for _, field := range structType.Fields.List {
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			key := prefix + "." + name.Name
+			if field.Doc != nil {
+				descriptions[key] = strings.Join(strings.Fields(field.Doc.Text()), " ")
+			}
+			nested, typeName := fieldStruct(field.Type)
+			switch {
+			case typeName != "":
+				if structs[typeName] != nil && !visited[typeName] {
+					visited[typeName] = true
+					collect(descriptions, structs, typeName, structs[typeName])
+				}
+			case nested != nil:
+				collect(descriptions, structs, key, nested)
+			}
+		}
+	}
+}
+
+// fieldStruct finds the anonymous struct or name of the type a field holds
+func fieldStruct(expr ast.Expr) (*ast.StructType, string) {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return t, ""
+	case *ast.Ident:
+		return nil, t.Name
+	case *ast.ArrayType:
+		return fieldStruct(t.Elt)
+	case *ast.MapType:
+		return fieldStruct(t.Value)
+	case *ast.StarExpr:
+		return fieldStruct(t.X)
+	}
+	return nil, ""
+}
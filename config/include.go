@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+)
+
+// chartOrigin is the file and field a chart or image value name was defined at
+type chartOrigin struct {
+	file  *GokuConfig
+	field string
+}
+
+func (o chartOrigin) String() string {
+	pos := o.file.source.position(o.field)
+	return fmt.Sprintf("%s:%d:%d", o.file.file, pos.Line, pos.Column)
+}
+
+type includeMerger struct {
+	config *GokuConfig
+	charts map[string]chartOrigin
+	// image values by chart name and value name, as each chart has its own values
+	imageValues map[[2]string]chartOrigin
+	// absolute paths of files already merged
+	merged map[string]bool
+	// included files which can't be read and charts or image values defined twice
+	errs ValidationErrors
+}
+
+// mergeIncludes builds one config from root and every file it includes.
+// Paths in included files are relative to their own directory and are
+// rewritten to be relative to the BaseDir of root. Includes which can't be
+// read or match no files and charts or image values of a chart defined twice
+// are returned as ValidationErrors.
+func mergeIncludes(root *GokuConfig) (*GokuConfig, error) {
+	config := *root
+	config.Charts = nil
+	config.Tools = make(map[string]map[string]string)
+	config.Hosts = nil
+	config.Profiles = make(map[string]Profile)
+
+	m := includeMerger{
+		config:      &config,
+		charts:      make(map[string]chartOrigin),
+		imageValues: make(map[[2]string]chartOrigin),
+		merged:      make(map[string]bool),
+	}
+	m.add(root, nil)
+	if len(m.errs) > 0 {
+		return nil, m.errs
+	}
+	return &config, nil
+}
+
+func (m *includeMerger) errorf(file *GokuConfig, field string, format string, args ...interface{}) {
+	m.errs = append(m.errs, ValidationError{
+		File:     file.file,
+		Position: file.source.position(field),
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// add merges file and then its includes. including holds the absolute
+// paths of the files currently being included, to detect cycles.
+func (m *includeMerger) add(file *GokuConfig, including []string) {
+	absPath, err := filepath.Abs(file.file)
+	if err != nil {
+		absPath = filepath.Clean(file.file)
+	}
+	m.merged[absPath] = true
+	including = append(including, absPath)
+	m.config.files = append(m.config.files, file)
+
+	for i, chart := range file.Charts {
+		chartField := fmt.Sprintf("charts[%d]", i)
+		if origin, ok := m.charts[chart.Name]; ok && chart.Name != "" {
+			m.errorf(file, chartField+".name", "chart %q is already defined at %s", chart.Name, origin)
+		} else {
+			m.charts[chart.Name] = chartOrigin{file, chartField + ".name"}
+		}
+
+		for j, image := range chart.Images {
+			imageField := fmt.Sprintf("%s.images[%d].imageValueName", chartField, j)
+			key := [2]string{chart.Name, image.ImageValueName}
+			if origin, ok := m.imageValues[key]; ok && image.ImageValueName != "" {
+				m.errorf(file, imageField, "imageValueName %q is already defined for chart %q at %s", image.ImageValueName, chart.Name, origin)
+			} else if !ok {
+				m.imageValues[key] = chartOrigin{file, imageField}
+			}
+		}
+		m.config.Charts = append(m.config.Charts, m.relocateChart(file, chart))
+		m.config.origins = append(m.config.origins, chartOrigin{file, chartField})
+	}
+
+	for name, profile := range file.Profiles {
+		charts := make([]Chart, len(profile.Charts))
+		for i, chart := range profile.Charts {
+			charts[i] = m.relocateChart(file, chart)
+		}
+		merged := m.config.Profiles[name]
+		merged.Charts = overlay(reflect.ValueOf(merged.Charts), reflect.ValueOf(charts)).Interface().([]Chart)
+		m.config.Profiles[name] = merged
+	}
+
+	for tool, urls := range file.Tools {
+		if _, ok := m.config.Tools[tool]; !ok {
+			m.config.Tools[tool] = urls
+		}
+	}
+	for _, host := range file.Hosts {
+		if !containsString(m.config.Hosts, host) {
+			m.config.Hosts = append(m.config.Hosts, host)
+		}
+	}
+
+	for i, pattern := range file.Include {
+		includeField := fmt.Sprintf("include[%d]", i)
+		matches, err := filepath.Glob(filepath.Join(file.BaseDir, pattern))
+		if err != nil {
+			m.errorf(file, includeField, "bad include pattern %q: %v", pattern, err)
+			continue
+		}
+		if len(matches) == 0 {
+			m.errorf(file, includeField, "no goku.yaml files match %q", pattern)
+			continue
+		}
+
+		for _, match := range matches {
+			absMatch, err := filepath.Abs(match)
+			if err != nil {
+				absMatch = filepath.Clean(match)
+			}
+			if containsString(including, absMatch) {
+				m.errorf(file, includeField, "include cycle, %s is already being included", match)
+				continue
+			}
+			if m.merged[absMatch] {
+				// already merged through another include
+				continue
+			}
+			included, err := readConfigFile(match)
+			if err != nil {
+				m.errorf(file, includeField, "%v", err)
+				continue
+			}
+			m.add(included, including)
+		}
+	}
+}
+
+// relocateChart copies a chart with its paths made relative to the BaseDir of the merged config
+func (m *includeMerger) relocateChart(file *GokuConfig, chart Chart) Chart {
+	chart.Path = m.relocate(file, chart.Path)
+	if chart.ValuesFiles != nil {
+		valuesFiles := make([]string, len(chart.ValuesFiles))
+		for i, valuesFile := range chart.ValuesFiles {
+			valuesFiles[i] = m.relocate(file, valuesFile)
+		}
+		chart.ValuesFiles = valuesFiles
+	}
+	chart.Images = append([]Image(nil), chart.Images...)
+	for i := range chart.Images {
+		image := &chart.Images[i]
+		image.Path = m.relocate(file, image.Path)
+		image.ContextPath = m.relocate(file, image.ContextPath)
+	}
+	return chart
+}
+
+// relocate makes a path relative to the BaseDir of file relative to the BaseDir of the merged config
+func (m *includeMerger) relocate(file *GokuConfig, relPath string) string {
+	if relPath == "" || file.BaseDir == m.config.BaseDir {
+		return relPath
+	}
+	rel, err := filepath.Rel(m.config.BaseDir, filepath.Join(file.BaseDir, relPath))
+	if err != nil {
+		return filepath.ToSlash(filepath.Join(file.BaseDir, relPath))
+	}
+	return filepath.ToSlash(rel)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
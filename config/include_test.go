@@ -0,0 +1,130 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfigs writes goku.yaml files with their content below dir
+func writeConfigs(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("apiVersion: "+CurrentVersion+"\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadConfigIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeConfigs(t, dir, map[string]string{
+		"goku.yaml": "include:\n- services/*/goku.yaml\ncharts:\n- name: web\n  path: web\nhosts:\n- web.goku.test\n",
+		"services/api/goku.yaml": "include:\n- ../../goku.yaml\ncharts:\n- name: api\n  path: chart\n  images:\n  - name: goku/api\n    imageValueName: image\n    path: .\n" +
+			"hosts:\n- web.goku.test\n- api.goku.test\n",
+	})
+
+	gokuConfig, err := ReadConfig(filepath.Join(dir, "goku.yaml"))
+	if err == nil {
+		// the include of goku.yaml is a cycle
+		t.Fatalf("ReadConfig() succeeded with an include cycle: %+v", gokuConfig)
+	}
+	if !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("ReadConfig() error = %v, want an include cycle", err)
+	}
+
+	writeConfigs(t, dir, map[string]string{
+		"services/api/goku.yaml": "charts:\n- name: api\n  path: chart\n  images:\n  - name: goku/api\n    imageValueName: image\n    path: .\n" +
+			"hosts:\n- web.goku.test\n- api.goku.test\n",
+	})
+	gokuConfig, err = ReadConfig(filepath.Join(dir, "goku.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gokuConfig.Charts) != 2 {
+		t.Fatalf("ReadConfig() charts = %+v, want web and api", gokuConfig.Charts)
+	}
+	api := gokuConfig.Charts[1]
+	if api.Path != "services/api/chart" || api.Images[0].Path != "services/api" {
+		t.Errorf("ReadConfig() api chart paths = %s and %s, want them relative to goku.yaml", api.Path, api.Images[0].Path)
+	}
+	if want := []string{"web.goku.test", "api.goku.test"}; !reflect.DeepEqual(gokuConfig.Hosts, want) {
+		t.Errorf("ReadConfig() hosts = %v, want %v", gokuConfig.Hosts, want)
+	}
+}
+
+func TestReadConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "no matching files",
+			files: map[string]string{"goku.yaml": "include:\n- missing/goku.yaml\ncharts:\n- name: web\n  path: web\n"},
+			want:  `include[0]: no goku.yaml files match "missing/goku.yaml"`,
+		},
+		{
+			name: "unparseable include",
+			files: map[string]string{
+				"goku.yaml":     "include:\n- api/goku.yaml\ncharts:\n- name: web\n  path: web\n",
+				"api/goku.yaml": "charts: [\n",
+			},
+			want: filepath.Join("api", "goku.yaml") + ": yaml",
+		},
+		{
+			name: "unreadable include",
+			files: map[string]string{
+				"goku.yaml":          "include:\n- api/*\ncharts:\n- name: web\n  path: web\n",
+				"api/goku.yaml/keep": "",
+			},
+			want: "include[0]: could not read goku config",
+		},
+		{
+			name: "chart defined twice",
+			files: map[string]string{
+				"goku.yaml":     "include:\n- api/goku.yaml\ncharts:\n- name: api\n  path: api\n",
+				"api/goku.yaml": "charts:\n- name: api\n  path: chart\n",
+			},
+			want: `charts[0].name: chart "api" is already defined at`,
+		},
+		{
+			name: "image value defined twice",
+			files: map[string]string{
+				"goku.yaml": "charts:\n- name: api\n  path: api\n  images:\n  - name: goku/api\n    imageValueName: image\n    path: .\n" +
+					"  - name: goku/worker\n    imageValueName: image\n    path: .\n",
+			},
+			want: `charts[0].images[1].imageValueName: imageValueName "image" is already defined for chart "api"`,
+		},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "goku-include")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeConfigs(t, dir, test.files)
+
+		gokuConfig, err := ReadConfig(filepath.Join(dir, "goku.yaml"))
+		if err == nil {
+			t.Errorf("%s: ReadConfig() = %+v, want an error", test.name, gokuConfig)
+			continue
+		}
+		if _, ok := err.(ValidationErrors); !ok {
+			t.Errorf("%s: ReadConfig() error %T is not ValidationErrors", test.name, err)
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: ReadConfig() error = %v, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ${VAR}, ${VAR:-default} or an escaped $$
+var envPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate replaces ${VAR} with the value of environment variable VAR in
+// the string scalars of decoded YAML. ${VAR:-default} uses default when VAR
+// is unset or empty and $$ is a literal $. Values are substituted after
+// decoding, so they can't change the structure of the YAML whatever they
+// contain. A scalar which then reads as a number or boolean becomes one, so
+// replicas: ${REPLICAS} is an int. Mapping keys are left alone. The names of
+// unset variables without a default are returned.
+func interpolate(value interface{}, lookupEnv func(string) (string, bool)) (interface{}, []string) {
+	var unset []string
+	var walk func(value interface{}) interface{}
+	walk = func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case yaml.MapSlice:
+			interpolated := make(yaml.MapSlice, len(value))
+			for i, item := range value {
+				interpolated[i] = yaml.MapItem{Key: item.Key, Value: walk(item.Value)}
+			}
+			return interpolated
+		case []interface{}:
+			interpolated := make([]interface{}, len(value))
+			for i, item := range value {
+				interpolated[i] = walk(item)
+			}
+			return interpolated
+		case string:
+			return interpolateString(value, lookupEnv, &unset)
+		default:
+			return value
+		}
+	}
+	return walk(value), unset
+}
+
+// interpolateString replaces the environment variables of a string scalar,
+// adding the unset ones to unset
+func interpolateString(s string, lookupEnv func(string) (string, bool), unset *[]string) interface{} {
+	if !envPattern.MatchString(s) {
+		return s
+	}
+	interpolated := envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		groups := envPattern.FindStringSubmatch(match)
+		name := groups[1]
+		value, ok := lookupEnv(name)
+		switch {
+		case groups[2] != "" && value == "":
+			return groups[3]
+		case !ok:
+			if !containsString(*unset, name) {
+				*unset = append(*unset, name)
+			}
+		}
+		return value
+	})
+
+	if strings.ContainsAny(interpolated, " \t\n#") {
+		return interpolated
+	}
+	var scalar interface{}
+	if err := yaml.Unmarshal([]byte(interpolated), &scalar); err == nil {
+		switch scalar.(type) {
+		case int, int64, uint64, float64, bool:
+			return scalar
+		}
+	}
+	return interpolated
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{
+		"REGISTRY": "registry:5000",
+		"EMPTY":    "",
+		"REPLICAS": "3",
+		"COMMENT":  "a # b",
+		"MAPPING":  "key: value",
+		"LINES":    "one\ntwo: 2",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	tests := []struct {
+		data  string
+		want  yaml.MapSlice
+		unset []string
+	}{
+		{"image: ${REGISTRY}/web", yaml.MapSlice{{Key: "image", Value: "registry:5000/web"}}, nil},
+		{"image: ${REGISTRY:-localhost}/web", yaml.MapSlice{{Key: "image", Value: "registry:5000/web"}}, nil},
+		{"image: ${MISSING:-localhost}/web", yaml.MapSlice{{Key: "image", Value: "localhost/web"}}, nil},
+		{"image: ${EMPTY:-localhost}/web", yaml.MapSlice{{Key: "image", Value: "localhost/web"}}, nil},
+		{"image: ${MISSING:-}/web", yaml.MapSlice{{Key: "image", Value: "/web"}}, nil},
+		{"tag: ${EMPTY}", yaml.MapSlice{{Key: "tag", Value: ""}}, nil},
+		{"price: $$5 and $HOME", yaml.MapSlice{{Key: "price", Value: "$5 and $HOME"}}, nil},
+		{"a: ${MISSING}\nb: ${MISSING} ${OTHER}", yaml.MapSlice{{Key: "a", Value: ""}, {Key: "b", Value: " "}}, []string{"MISSING", "OTHER"}},
+		{"a: ${REGISTRY} # ${MISSING}", yaml.MapSlice{{Key: "a", Value: "registry:5000"}}, nil},
+		{`a: "${REGISTRY} # quoted"`, yaml.MapSlice{{Key: "a", Value: "registry:5000 # quoted"}}, nil},
+		{"a: ${1INVALID}", yaml.MapSlice{{Key: "a", Value: "${1INVALID}"}}, nil},
+		{"${REGISTRY}: key", yaml.MapSlice{{Key: "${REGISTRY}", Value: "key"}}, nil},
+		// values can't change the structure of the YAML
+		{"a: ${COMMENT}", yaml.MapSlice{{Key: "a", Value: "a # b"}}, nil},
+		{"a: ${MAPPING}", yaml.MapSlice{{Key: "a", Value: "key: value"}}, nil},
+		{"a: ${LINES}\nb: 1", yaml.MapSlice{{Key: "a", Value: "one\ntwo: 2"}, {Key: "b", Value: 1}}, nil},
+		{"a:\n  b:\n  - ${REGISTRY}", yaml.MapSlice{{Key: "a", Value: yaml.MapSlice{{Key: "b", Value: []interface{}{"registry:5000"}}}}}, nil},
+		// numbers and booleans are decoded as such
+		{"replicas: ${REPLICAS}", yaml.MapSlice{{Key: "replicas", Value: 3}}, nil},
+		{"replicas: ${MISSING:-1}", yaml.MapSlice{{Key: "replicas", Value: 1}}, nil},
+		{"debug: ${MISSING:-true}", yaml.MapSlice{{Key: "debug", Value: true}}, nil},
+		{`version: "1.10"`, yaml.MapSlice{{Key: "version", Value: "1.10"}}, nil},
+	}
+	for _, test := range tests {
+		var data yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(test.data), &data); err != nil {
+			t.Fatalf("%q: %v", test.data, err)
+		}
+		got, unset := interpolate(data, lookupEnv)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("interpolate(%q) = %#v, want %#v", test.data, got, test.want)
+		}
+		if !reflect.DeepEqual(unset, test.unset) {
+			t.Errorf("interpolate(%q) reported unset %v, want %v", test.data, unset, test.unset)
+		}
+	}
+}
+
+func TestReadConfigInterpolate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "goku.yaml")
+	data := "apiVersion: " + CurrentVersion + `
+build:
+  concurrency: ${GOKU_TEST_CONCURRENCY}
+charts:
+- name: web
+  path: web
+  values:
+    note: ${GOKU_TEST_NOTE}
+    replicas: ${GOKU_TEST_REPLICAS:-2}
+`
+	if err := ioutil.WriteFile(configPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GOKU_TEST_CONCURRENCY", "4")
+	defer os.Unsetenv("GOKU_TEST_CONCURRENCY")
+	os.Setenv("GOKU_TEST_NOTE", "a: b # c\nd")
+	defer os.Unsetenv("GOKU_TEST_NOTE")
+
+	gokuConfig, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gokuConfig.Build.Concurrency != 4 {
+		t.Errorf("ReadConfig() build concurrency = %d, want 4", gokuConfig.Build.Concurrency)
+	}
+	want := map[string]interface{}{"note": "a: b # c\nd", "replicas": 2}
+	if len(gokuConfig.Charts) != 1 || !reflect.DeepEqual(gokuConfig.Charts[0].Values, want) {
+		t.Errorf("ReadConfig() charts = %+v, want values %v", gokuConfig.Charts, want)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// WithProfile returns a copy of the config with the named profile laid over
+// it. Charts and images are matched by name, values are merged and any other
+// field set in the profile replaces the original. An empty name returns the
+// config unchanged.
+func (c *GokuConfig) WithProfile(name string) (*GokuConfig, error) {
+	if name == "" {
+		return c, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q is not defined, available profiles: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	config := *c
+	config.Charts = overlay(reflect.ValueOf(c.Charts), reflect.ValueOf(profile.Charts)).Interface().([]Chart)
+	config.profile = name
+	return &config, nil
+}
+
+// ProfileNames lists the profiles defined in goku.yaml in alphabetical order
+func (c *GokuConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overlay returns a copy of base with the non-empty parts of over laid on
+// top. Neither base nor over are modified.
+func overlay(base reflect.Value, over reflect.Value) reflect.Value {
+	switch base.Kind() {
+	case reflect.Struct:
+		out := reflect.New(base.Type()).Elem()
+		out.Set(base)
+		for i := 0; i < base.NumField(); i++ {
+			if _, _, ok := yamlName(base.Type().Field(i)); ok {
+				out.Field(i).Set(overlay(base.Field(i), over.Field(i)))
+			}
+		}
+		return out
+	case reflect.Slice:
+		if over.Len() == 0 {
+			return base
+		}
+		if !hasName(base.Type().Elem()) {
+			return over
+		}
+		// items with the same name are laid over each other, the rest appended
+		out := reflect.AppendSlice(reflect.MakeSlice(base.Type(), 0, base.Len()+over.Len()), base)
+		for i := 0; i < over.Len(); i++ {
+			item := over.Index(i)
+			matched := false
+			for j := 0; j < out.Len(); j++ {
+				if out.Index(j).FieldByName("Name").String() == item.FieldByName("Name").String() {
+					out.Index(j).Set(overlay(out.Index(j), item))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				out = reflect.Append(out, item)
+			}
+		}
+		return out
+	case reflect.Map:
+		if over.Len() == 0 {
+			return base
+		}
+		out := reflect.MakeMap(base.Type())
+		for _, key := range base.MapKeys() {
+			out.SetMapIndex(key, base.MapIndex(key))
+		}
+		for _, key := range over.MapKeys() {
+			value := over.MapIndex(key)
+			if existing := out.MapIndex(key); existing.IsValid() {
+				value = overlay(existing, value)
+			}
+			out.SetMapIndex(key, value)
+		}
+		return out
+	case reflect.Interface:
+		if over.IsNil() {
+			return base
+		}
+		if base.IsNil() {
+			return over
+		}
+		return reflect.ValueOf(mergeValue(base.Interface(), over.Interface()))
+	}
+	if isZero(over) {
+		return base
+	}
+	return over
+}
+
+// hasName reports if t is a struct with a Name to match items on
+func hasName(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	field, ok := t.FieldByName("Name")
+	return ok && field.Type.Kind() == reflect.String
+}
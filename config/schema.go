@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+)
+
+//go:generate go run gen_descriptions.go
+
+// fieldEnums are the values allowed for string fields, by fieldDescriptions key
+var fieldEnums = map[string][]string{
+	"Image.ImageValueFormat": {ImageValueFull, ImageValueSplit, ImageValueID},
+	"Image.Builder":          {BuilderDocker, BuilderCLI, BuilderBuildx, BuilderCommand, BuilderGo},
+}
+
+// JSONSchema describes goku.yaml for editors to autocomplete and lint with.
+// It is built from the same struct tags Validate checks against: unknown keys
+// are rejected and every field without omitempty is required.
+func JSONSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(GokuConfig{}), "GokuConfig", false)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "goku.yaml"
+	return schema
+}
+
+// typeSchema converts a config type to JSON Schema. key is the name of the
+// field in fieldDescriptions, such as Image.Path. Nothing is required in
+// overlays such as profiles.
+func typeSchema(t reflect.Type, key string, overlay bool) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), key, overlay)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), key, overlay)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), key, overlay)}
+	case reflect.Struct:
+		if t.Name() != "" {
+			key = t.Name()
+		}
+		if t == reflect.TypeOf(Profile{}) {
+			overlay = true
+		}
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, omitempty, ok := yamlName(field)
+			if !ok {
+				continue
+			}
+			fieldKey := key + "." + field.Name
+			property := typeSchema(field.Type, fieldKey, overlay)
+			if description, ok := fieldDescriptions[fieldKey]; ok {
+				property["description"] = description
+			}
+			if enum, ok := fieldEnums[fieldKey]; ok {
+				property["enum"] = enum
+			}
+			if !omitempty && !overlay {
+				required = append(required, name)
+				// Validate treats empty values as missing
+				switch property["type"] {
+				case "string":
+					property["minLength"] = 1
+				case "array":
+					property["minItems"] = 1
+				case "object":
+					property["minProperties"] = 1
+				}
+			}
+			properties[name] = property
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	// free form values
+	return map[string]interface{}{}
+}
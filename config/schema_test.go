@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+type schemaExample struct {
+	Name    string                 `yaml:"name"`
+	Count   int                    `yaml:"count,omitempty"`
+	Ratio   float64                `yaml:"ratio,omitempty"`
+	Enabled bool                   `yaml:"enabled,omitempty"`
+	Tags    []string               `yaml:"tags"`
+	Labels  map[string]string      `yaml:"labels"`
+	Values  map[string]interface{} `yaml:"values,omitempty"`
+	Nested  *struct {
+		Path string `yaml:"path,omitempty"`
+	} `yaml:"nested,omitempty"`
+	Skipped string `yaml:"-"`
+	hidden  string
+}
+
+func TestTypeSchema(t *testing.T) {
+	schema := typeSchema(reflect.TypeOf(schemaExample{}), "schemaExample", false)
+	if schema["additionalProperties"] != false {
+		t.Errorf("additionalProperties = %v, want false", schema["additionalProperties"])
+	}
+	if required := schema["required"]; !reflect.DeepEqual(required, []string{"name", "tags", "labels"}) {
+		t.Errorf("required = %v, want the fields without omitempty", required)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	tests := []struct {
+		name string
+		want map[string]interface{}
+	}{
+		{"name", map[string]interface{}{"type": "string", "minLength": 1}},
+		{"count", map[string]interface{}{"type": "integer"}},
+		{"ratio", map[string]interface{}{"type": "number"}},
+		{"enabled", map[string]interface{}{"type": "boolean"}},
+		{"tags", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 1}},
+		{"labels", map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}, "minProperties": 1}},
+		{"values", map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{}}},
+		{"nested", map[string]interface{}{
+			"type":                 "object",
+			"properties":           map[string]interface{}{"path": map[string]interface{}{"type": "string"}},
+			"additionalProperties": false,
+		}},
+	}
+	for _, test := range tests {
+		if got := properties[test.name]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("schema of %s = %v, want %v", test.name, got, test.want)
+		}
+	}
+	for _, name := range []string{"Skipped", "skipped", "hidden"} {
+		if _, ok := properties[name]; ok {
+			t.Errorf("schema has a property for the ignored field %s", name)
+		}
+	}
+}
+
+func TestTypeSchemaOverlay(t *testing.T) {
+	schema := typeSchema(reflect.TypeOf(schemaExample{}), "schemaExample", true)
+	if required, ok := schema["required"]; ok {
+		t.Errorf("overlay requires %v, want nothing required", required)
+	}
+	name := schema["properties"].(map[string]interface{})["name"]
+	if want := map[string]interface{}{"type": "string"}; !reflect.DeepEqual(name, want) {
+		t.Errorf("overlay schema of name = %v, want %v", name, want)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema()
+	if schema["$schema"] != "http://json-schema.org/draft-07/schema#" {
+		t.Errorf("$schema = %v", schema["$schema"])
+	}
+	charts, ok := schema["properties"].(map[string]interface{})["charts"].(map[string]interface{})
+	if !ok {
+		t.Fatal("the schema has no charts property")
+	}
+	if charts["description"] != fieldDescriptions["GokuConfig.Charts"] || charts["description"] == "" {
+		t.Errorf("charts description = %q, want its doc comment", charts["description"])
+	}
+	items := charts["items"].(map[string]interface{})
+	for _, name := range []string{"name", "path"} {
+		property, ok := items["properties"].(map[string]interface{})[name].(map[string]interface{})
+		if !ok || property["description"] == nil {
+			t.Errorf("chart property %s is missing or has no description", name)
+		}
+	}
+}
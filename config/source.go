@@ -0,0 +1,204 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Position of a key or sequence item in a goku.yaml file
+type Position struct {
+	Line   int
+	Column int
+}
+
+// sourceKey is a mapping key or sequence item found in the YAML source
+type sourceKey struct {
+	// Field path such as charts[0].images[1].path
+	Path string
+	Position
+}
+
+// sourceIndex maps field paths to where they were written in the YAML source.
+// It understands the block style goku.yaml is written in. Flow style
+// collections ({...} and [...]) are indexed as a single value.
+type sourceIndex struct {
+	keys      []sourceKey
+	positions map[string]Position
+}
+
+type sourceFrame struct {
+	indent   int
+	path     string
+	sequence bool
+	index    int
+}
+
+func newSourceIndex(data []byte) *sourceIndex {
+	idx := &sourceIndex{positions: make(map[string]Position)}
+
+	var stack []*sourceFrame
+	// key (or sequence item) with no inline value whose children may follow
+	pendingPath, pendingIndent := "", -1
+	// skip the lines of a block scalar (| or >) deeper than this indent
+	blockIndent := -1
+
+	lines := strings.Split(string(data), "\n")
+	for i, raw := range lines {
+		lineNo := i + 1
+		line := strings.TrimRight(raw, " \t\r")
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+
+		if blockIndent >= 0 {
+			if content == "" || indent > blockIndent {
+				continue
+			}
+			blockIndent = -1
+		}
+		content = stripComment(content)
+		if content == "" || content == "---" || content == "..." {
+			continue
+		}
+
+		// close every collection indented deeper than this line
+		for len(stack) > 0 && stack[len(stack)-1].indent > indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		prefix := ""
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			if pendingPath != "" && indent >= pendingIndent {
+				stack = append(stack, &sourceFrame{indent: indent, path: pendingPath, sequence: true, index: -1})
+			} else {
+				for len(stack) > 0 && !(stack[len(stack)-1].sequence && stack[len(stack)-1].indent == indent) {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			pendingPath, pendingIndent = "", -1
+			if len(stack) == 0 {
+				// top level sequences are not part of goku.yaml
+				continue
+			}
+			seq := stack[len(stack)-1]
+			seq.index++
+			itemPath := seq.path + "[" + strconv.Itoa(seq.index) + "]"
+			idx.add(itemPath, lineNo, indent+1)
+
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			if rest == "" {
+				pendingPath, pendingIndent = itemPath, indent
+				continue
+			}
+			if _, _, ok := splitKey(rest); !ok {
+				continue
+			}
+			// the item is a mapping starting on the same line as its dash
+			indent += len(content) - len(rest)
+			stack = append(stack, &sourceFrame{indent: indent, path: itemPath})
+			content = rest
+			prefix = itemPath
+		} else {
+			if _, _, ok := splitKey(content); !ok {
+				pendingPath, pendingIndent = "", -1
+				continue
+			}
+			if pendingPath != "" && indent > pendingIndent {
+				stack = append(stack, &sourceFrame{indent: indent, path: pendingPath})
+			} else {
+				for len(stack) > 0 && (stack[len(stack)-1].sequence || stack[len(stack)-1].indent > indent) {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			if len(stack) == 0 {
+				stack = append(stack, &sourceFrame{indent: indent})
+			}
+			prefix = stack[len(stack)-1].path
+		}
+
+		key, value, _ := splitKey(content)
+		keyPath := key
+		if prefix != "" {
+			keyPath = prefix + "." + key
+		}
+		idx.add(keyPath, lineNo, indent+1)
+
+		pendingPath, pendingIndent = "", -1
+		switch {
+		case value == "":
+			pendingPath, pendingIndent = keyPath, indent
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			blockIndent = indent
+		}
+	}
+	return idx
+}
+
+func (idx *sourceIndex) add(path string, line, column int) {
+	pos := Position{Line: line, Column: column}
+	idx.keys = append(idx.keys, sourceKey{Path: path, Position: pos})
+	idx.positions[path] = pos
+}
+
+// position of the field path, or of its closest parent written in the source
+func (idx *sourceIndex) position(path string) Position {
+	if idx == nil {
+		return Position{}
+	}
+	for path != "" {
+		if pos, ok := idx.positions[path]; ok {
+			return pos
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return Position{}
+}
+
+// splitKey splits "key: value" into its unquoted key and value
+func splitKey(content string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ':' && (i+1 == len(content) || content[i+1] == ' '):
+			key := strings.Trim(strings.TrimSpace(content[:i]), `"'`)
+			return key, strings.TrimSpace(content[i+1:]), key != ""
+		case c == '{' || c == '[':
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// stripComment removes a trailing # comment that is not inside quotes
+func stripComment(content string) string {
+	return strings.TrimRight(content[:commentStart(content)], " \t")
+}
+
+// commentStart is the index of the # starting a comment, or len(line) if there is none
+func commentStart(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return i
+		}
+	}
+	return len(line)
+}
@@ -0,0 +1,98 @@
+package config
+
+import "testing"
+
+const sourceYAML = `apiVersion: goku/v1 # comment
+charts:
+  - name: app
+    path: charts/app
+    images:
+      - name: web
+        path: web
+      -
+        name: worker
+        ignore: ["*.pyc"]
+    values:
+      note: |
+        name: not a key
+      replicas: 2
+watch:
+  gitignore: true
+`
+
+func TestSourceIndexPosition(t *testing.T) {
+	idx := newSourceIndex([]byte(sourceYAML))
+	tests := []struct {
+		path string
+		want Position
+	}{
+		{"apiVersion", Position{Line: 1, Column: 1}},
+		{"charts", Position{Line: 2, Column: 1}},
+		{"charts[0]", Position{Line: 3, Column: 3}},
+		{"charts[0].name", Position{Line: 3, Column: 5}},
+		{"charts[0].path", Position{Line: 4, Column: 5}},
+		{"charts[0].images[0].name", Position{Line: 6, Column: 9}},
+		{"charts[0].images[0].path", Position{Line: 7, Column: 9}},
+		{"charts[0].images[1]", Position{Line: 8, Column: 7}},
+		{"charts[0].images[1].name", Position{Line: 9, Column: 9}},
+		{"charts[0].images[1].ignore", Position{Line: 10, Column: 9}},
+		{"charts[0].values.note", Position{Line: 12, Column: 7}},
+		{"charts[0].values.replicas", Position{Line: 14, Column: 7}},
+		{"watch.gitignore", Position{Line: 16, Column: 3}},
+		// fields which are not written fall back to their closest parent
+		{"charts[0].images[1].ignore[0]", Position{Line: 10, Column: 9}},
+		{"charts[0].images[0].dockerFile", Position{Line: 6, Column: 7}},
+		{"charts[1].name", Position{Line: 2, Column: 1}},
+		{"profiles", Position{}},
+	}
+	for _, test := range tests {
+		if got := idx.position(test.path); got != test.want {
+			t.Errorf("position(%q) = %+v, want %+v", test.path, got, test.want)
+		}
+	}
+	if _, ok := idx.positions["charts[0].values.note.name"]; ok {
+		t.Error("a line of a block scalar was indexed as a key")
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		content string
+		key     string
+		value   string
+		ok      bool
+	}{
+		{"name: web", "name", "web", true},
+		{"name:", "name", "", true},
+		{`"quoted: key": value`, "quoted: key", "value", true},
+		{"image: registry:5000/web", "image", "registry:5000/web", true},
+		{"url:http://host", "", "", false},
+		{"{a: b}", "", "", false},
+		{"plain value", "", "", false},
+		{": value", "", "value", false},
+	}
+	for _, test := range tests {
+		key, value, ok := splitKey(test.content)
+		if key != test.key || value != test.value || ok != test.ok {
+			t.Errorf("splitKey(%q) = %q, %q, %v, want %q, %q, %v", test.content, key, value, ok, test.key, test.value, test.ok)
+		}
+	}
+}
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"name: web # the web image", "name: web"},
+		{"# only a comment", ""},
+		{`tag: "v1 # not a comment"`, `tag: "v1 # not a comment"`},
+		{"path: a#b", "path: a#b"},
+		{"name: web\t# tab", "name: web"},
+	}
+	for _, test := range tests {
+		if got := stripComment(test.content); got != test.want {
+			t.Errorf("stripComment(%q) = %q, want %q", test.content, got, test.want)
+		}
+	}
+}
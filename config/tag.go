@@ -0,0 +1,35 @@
+package config
+
+import (
+	"io/ioutil"
+	"text/template"
+	"time"
+)
+
+// TagData is what a tagPolicy template can use to tag an image
+type TagData struct {
+	// Image name (repository)
+	Name string
+	// Tag of the timestamp policy
+	Timestamp string
+	// Time the build started
+	Time time.Time
+	// Short git commit SHA of the build context
+	GitCommit string
+	// Build context has uncommitted changes
+	GitDirty bool
+	// Tag of the contentHash policy
+	ContentHash string
+}
+
+// ParseTagTemplate parses a tagPolicy template and checks it only uses TagData
+func ParseTagTemplate(policy string) (*template.Template, error) {
+	tmpl, err := template.New("tagPolicy").Parse(policy)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(ioutil.Discard, TagData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckTagPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{policy: ""},
+		{policy: TagTimestamp},
+		{policy: TagGitCommit},
+		{policy: TagContentHash},
+		{policy: "{{.GitCommit}}-{{.ContentHash}}"},
+		{policy: `{{.Time.Format "20060102"}}`},
+		{policy: "latest", want: []string{`build.tagPolicy: unknown tag policy "latest", must be timestamp, gitCommit, contentHash or a template such as {{.GitCommit}}`}},
+		{policy: "{{.GitCommit", want: []string{`build.tagPolicy: template: tagPolicy:1: unclosed action`}},
+		{policy: "{{.Branch}}", want: []string{`build.tagPolicy: template: tagPolicy:1:2: executing "tagPolicy" at <.Branch>: can't evaluate field Branch in type config.TagData`}},
+	}
+	for _, test := range tests {
+		v := &validator{}
+		v.checkTagPolicy("build.tagPolicy", test.policy)
+		var got []string
+		for _, err := range v.errs {
+			got = append(got, err.Field+": "+err.Message)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("checkTagPolicy(%q) = %q, want %q", test.policy, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/timatooth/goku/ignore"
+)
+
+// ValidationError is a single problem found in goku.yaml
+type ValidationError struct {
+	// goku.yaml file the problem was found in
+	File string
+	// Line and Column of the offending key, or of its closest parent when the key is missing
+	Position
+	// Field path such as charts[0].images[1].path
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Field, e.Message)
+}
+
+// ValidationErrors is every problem found in goku.yaml
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Validate checks goku.yaml and the files it includes for unknown keys,
+// missing required fields and paths which do not exist below BaseDir. Every
+// problem found is returned as ValidationErrors, or nil when the config is
+// valid.
+func (c *GokuConfig) Validate() error {
+	files := c.files
+	if len(files) == 0 {
+		files = []*GokuConfig{c}
+	}
+
+	var errs ValidationErrors
+	for _, file := range files {
+		errs = append(errs, file.validateFile()...)
+	}
+	if len(c.Charts) == 0 {
+		errs = append(errs, ValidationError{File: c.file, Message: "no charts defined"})
+	}
+	errs = append(errs, c.validateDependencies()...)
+	errs = append(errs, c.validateProfiles()...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateFile checks a single goku.yaml file as it was written
+func (c *GokuConfig) validateFile() ValidationErrors {
+	v := newValidator(c)
+	v.checkKeys()
+	v.checkRequired(reflect.ValueOf(c).Elem(), "")
+	v.checkPaths(c.Charts)
+	v.checkImageValues(c.Charts)
+	v.checkBuilders(c.Charts)
+	v.checkTagPolicy("build.tagPolicy", c.Build.TagPolicy)
+	if c.Build.Concurrency < 0 {
+		v.errorf("build.concurrency", "must not be negative")
+	}
+	v.checkDuration("watch.debounce", c.Watch.Debounce)
+	for i, chart := range c.Charts {
+		for j, image := range chart.Images {
+			field := fmt.Sprintf("charts[%d].images[%d]", i, j)
+			v.checkTagPolicy(field+".tagPolicy", image.TagPolicy)
+			v.checkDuration(field+".debounce", image.Debounce)
+			if _, err := ignore.NewGlobs(image.Ignore); err != nil {
+				v.errorf(field+".ignore", "%v", err)
+			}
+		}
+	}
+	return v.errs
+}
+
+// validateProfiles checks the paths and dependencies of the merged config
+// with each profile laid over it. Problems the config has without the profile
+// are left out.
+func (c *GokuConfig) validateProfiles() ValidationErrors {
+	if len(c.Profiles) == 0 {
+		return nil
+	}
+	base := validator{file: c.file, baseDir: c.BaseDir}
+	base.checkPaths(c.Charts)
+	known := make(map[string]bool)
+	for _, err := range append(base.errs, c.validateDependencies()...) {
+		known[err.Field+err.Message] = true
+	}
+
+	var errs ValidationErrors
+	for _, name := range c.ProfileNames() {
+		profiled, err := c.WithProfile(name)
+		if err != nil {
+			continue
+		}
+		v := validator{file: c.file, baseDir: c.BaseDir}
+		v.checkPaths(profiled.Charts)
+		for _, err := range append(v.errs, profiled.validateDependencies()...) {
+			if !known[err.Field+err.Message] {
+				err.Message = fmt.Sprintf("with profile %q: %s", name, err.Message)
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+type validator struct {
+	file    string
+	source  *sourceIndex
+	baseDir string
+	errs    ValidationErrors
+}
+
+func newValidator(c *GokuConfig) *validator {
+	return &validator{file: c.file, source: c.source, baseDir: c.BaseDir}
+}
+
+func (v *validator) errorf(field string, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{
+		File:     v.file,
+		Position: v.source.position(field),
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkPaths reports chart, values file, image, context and Dockerfile paths
+// which do not exist, values files which are not YAML and build targets
+// missing from their Dockerfile
+func (v *validator) checkPaths(charts []Chart) {
+	for i, chart := range charts {
+		chartField := fmt.Sprintf("charts[%d]", i)
+		if chart.Path != "" && v.checkDir(chartField+".path", chart.Path) {
+			if _, err := os.Stat(filepath.Join(v.baseDir, chart.Path, "Chart.yaml")); err != nil {
+				v.errorf(chartField+".path", "%q is not a Helm chart, Chart.yaml not found", chart.Path)
+			}
+		}
+		for j, valuesFile := range chart.ValuesFiles {
+			valuesField := fmt.Sprintf("%s.valuesFiles[%d]", chartField, j)
+			if _, err := readValuesFile(filepath.Join(v.baseDir, valuesFile)); err != nil {
+				v.errorf(valuesField, "%v", err)
+			}
+		}
+
+		for j, image := range chart.Images {
+			imageField := fmt.Sprintf("%s.images[%d]", chartField, j)
+			contextOK := image.Path != "" && v.checkDir(imageField+".path", image.Path)
+
+			contextField, contextPath := imageField+".path", image.Path
+			if image.ContextPath != "" {
+				contextField, contextPath = imageField+".contextPath", image.ContextPath
+				contextOK = v.checkDir(contextField, contextPath)
+			}
+			// commands and the go builder build without a Dockerfile
+			if !contextOK || image.Builder == BuilderCommand || image.Builder == BuilderGo {
+				continue
+			}
+
+			dockerfileField, dockerfile := imageField+".dockerfile", image.Dockerfile
+			if dockerfile == "" {
+				dockerfileField, dockerfile = contextField, "Dockerfile"
+			}
+			if v.checkDockerfile(dockerfileField, contextPath, dockerfile) && image.Target != "" {
+				v.checkTarget(imageField+".target", filepath.Join(contextPath, dockerfile), image.Target)
+			}
+		}
+	}
+}
+
+// checkImageValues reports image value paths which can't be parsed and unknown formats
+func (v *validator) checkImageValues(charts []Chart) {
+	for i, chart := range charts {
+		for j, image := range chart.Images {
+			imageField := fmt.Sprintf("charts[%d].images[%d]", i, j)
+			if image.ImageValueName != "" {
+				if err := ValidValuePath(image.ImageValueName); err != nil {
+					v.errorf(imageField+".imageValueName", "%v", err)
+				}
+			}
+			v.checkEnum(imageField+".imageValueFormat", "Image.ImageValueFormat", image.ImageValueFormat)
+		}
+	}
+}
+
+// checkBuilders reports unknown builders and commands missing or set without
+// their builder
+func (v *validator) checkBuilders(charts []Chart) {
+	for i, chart := range charts {
+		for j, image := range chart.Images {
+			imageField := fmt.Sprintf("charts[%d].images[%d]", i, j)
+			v.checkEnum(imageField+".builder", "Image.Builder", image.Builder)
+			switch {
+			case image.Builder == BuilderCommand && image.Command == "":
+				v.errorf(imageField+".command", "missing required field %q for builder %q", "command", BuilderCommand)
+			case image.Builder != BuilderCommand && image.Command != "":
+				v.errorf(imageField+".command", "command is only run with builder %q", BuilderCommand)
+			}
+			if image.Builder != BuilderGo && !isZero(reflect.ValueOf(image.Go)) {
+				v.errorf(imageField+".go", "go is only used with builder %q", BuilderGo)
+			}
+		}
+	}
+}
+
+// checkEnum reports a value which is not one of the fieldEnums of its field
+func (v *validator) checkEnum(field string, key string, value string) {
+	if value != "" && !containsString(fieldEnums[key], value) {
+		v.errorf(field, "unknown value %q, must be one of %s", value, strings.Join(fieldEnums[key], ", "))
+	}
+}
+
+// checkTagPolicy reports unknown tag policies and templates which don't parse
+func (v *validator) checkTagPolicy(field string, policy string) {
+	switch {
+	case policy == "", policy == TagTimestamp, policy == TagGitCommit, policy == TagContentHash:
+	case strings.Contains(policy, "{{"):
+		if _, err := ParseTagTemplate(policy); err != nil {
+			v.errorf(field, "%v", err)
+		}
+	default:
+		v.errorf(field, "unknown tag policy %q, must be %s, %s, %s or a template such as {{.GitCommit}}",
+			policy, TagTimestamp, TagGitCommit, TagContentHash)
+	}
+}
+
+// checkDuration reports durations which don't parse or are negative
+func (v *validator) checkDuration(field string, duration string) {
+	if duration == "" {
+		return
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		v.errorf(field, "invalid duration %q, such as 500ms or 2s", duration)
+	} else if d < 0 {
+		v.errorf(field, "must not be negative")
+	}
+}
+
+// checkKeys reports every key in the source which has no matching config field
+func (v *validator) checkKeys() {
+	if v.source == nil {
+		return
+	}
+	configType := reflect.TypeOf(GokuConfig{})
+	for _, key := range v.source.keys {
+		parent, name, known := lookupField(configType, key.Path)
+		if known {
+			continue
+		}
+		message := fmt.Sprintf("unknown field %q", name)
+		if suggestion := closestField(parent, name); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %q?", suggestion)
+		}
+		v.errs = append(v.errs, ValidationError{
+			File:     v.file,
+			Position: key.Position,
+			Field:    key.Path,
+			Message:  message,
+		})
+	}
+}
+
+// checkRequired reports zero valued fields which are not tagged omitempty
+func (v *validator) checkRequired(value reflect.Value, field string) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			v.checkRequired(value.Elem(), field)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			v.checkRequired(value.Index(i), fmt.Sprintf("%s[%d]", field, i))
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			v.checkRequired(value.MapIndex(key), joinField(field, fmt.Sprint(key.Interface())))
+		}
+	case reflect.Struct:
+		if value.Type() == reflect.TypeOf(Profile{}) {
+			// profiles only hold the fields they change
+			return
+		}
+		for i := 0; i < value.NumField(); i++ {
+			name, omitempty, ok := yamlName(value.Type().Field(i))
+			if !ok {
+				continue
+			}
+			childField := joinField(field, name)
+			child := value.Field(i)
+			if !omitempty && isZero(child) {
+				v.errorf(childField, "missing required field %q", name)
+				continue
+			}
+			v.checkRequired(child, childField)
+		}
+	}
+}
+
+// checkDir reports a path relative to BaseDir which is not an existing directory
+func (v *validator) checkDir(field string, relPath string) bool {
+	info, err := os.Stat(filepath.Join(v.baseDir, relPath))
+	switch {
+	case os.IsNotExist(err):
+		v.errorf(field, "directory %q does not exist", relPath)
+	case err != nil:
+		v.errorf(field, "%v", err)
+	case !info.IsDir():
+		v.errorf(field, "%q is not a directory", relPath)
+	default:
+		return true
+	}
+	return false
+}
+
+// checkDockerfile reports a Dockerfile which is missing or outside of its build context
+func (v *validator) checkDockerfile(field string, contextPath string, dockerfile string) bool {
+	rel, err := filepath.Rel(contextPath, filepath.Join(contextPath, dockerfile))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(dockerfile) {
+		v.errorf(field, "Dockerfile %q must be inside the build context %q", dockerfile, contextPath)
+		return false
+	}
+	info, err := os.Stat(filepath.Join(v.baseDir, contextPath, dockerfile))
+	switch {
+	case os.IsNotExist(err):
+		v.errorf(field, "Dockerfile %q does not exist in build context %q", dockerfile, contextPath)
+	case err != nil:
+		v.errorf(field, "%v", err)
+	case info.IsDir():
+		v.errorf(field, "Dockerfile %q is a directory", dockerfile)
+	default:
+		return true
+	}
+	return false
+}
+
+// checkTarget reports a target which is not a stage named in the Dockerfile
+func (v *validator) checkTarget(field string, dockerfile string, target string) {
+	data, err := ioutil.ReadFile(filepath.Join(v.baseDir, dockerfile))
+	if err != nil {
+		v.errorf(field, "%v", err)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// FROM [--flags] image AS name
+		words := strings.Fields(line)
+		n := len(words)
+		if n >= 4 && strings.EqualFold(words[0], "FROM") && strings.EqualFold(words[n-2], "AS") &&
+			strings.EqualFold(words[n-1], target) {
+			return
+		}
+	}
+	v.errorf(field, "stage %q not found in Dockerfile %q", target, dockerfile)
+}
+
+// lookupField resolves a source field path against the config types. When a
+// key is unknown the type it should belong to and its name are returned.
+func lookupField(t reflect.Type, path string) (reflect.Type, string, bool) {
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		name := segment
+		if cut := strings.Index(segment, "["); cut >= 0 {
+			name = segment[:cut]
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			if t.Elem().Kind() != reflect.Struct {
+				// free form values, any key is allowed
+				return t, name, true
+			}
+			t = t.Elem()
+		case reflect.Interface:
+			return t, name, true
+		case reflect.Struct:
+			field, ok := fieldByYamlName(t, name)
+			if !ok {
+				// only the first unknown key is reported, not its children
+				return t, name, i < len(segments)-1
+			}
+			t = field.Type
+		}
+		for n := strings.Count(segment, "["); n > 0; n-- {
+			if t.Kind() != reflect.Slice {
+				break
+			}
+			t = t.Elem()
+		}
+	}
+	return t, "", true
+}
+
+func fieldByYamlName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if fieldName, _, ok := yamlName(t.Field(i)); ok && fieldName == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// closestField suggests a known field for a misspelt key
+func closestField(t reflect.Type, name string) string {
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	best, bestDistance := "", 4
+	for i := 0; i < t.NumField(); i++ {
+		fieldName, _, ok := yamlName(t.Field(i))
+		if !ok {
+			continue
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(fieldName)); d < bestDistance {
+			best, bestDistance = fieldName, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// yamlName returns the goku.yaml key of a struct field and if it is optional
+func yamlName(field reflect.StructField) (string, bool, bool) {
+	if field.PkgPath != "" {
+		return "", false, false
+	}
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	omitempty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
+
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+func joinField(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckDuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     []string
+	}{
+		{duration: ""},
+		{duration: "500ms"},
+		{duration: "0s"},
+		{duration: "1m30s"},
+		{duration: "500", want: []string{`watch.debounce: invalid duration "500", such as 500ms or 2s`}},
+		{duration: "soon", want: []string{`watch.debounce: invalid duration "soon", such as 500ms or 2s`}},
+		{duration: "-1s", want: []string{"watch.debounce: must not be negative"}},
+	}
+	for _, test := range tests {
+		v := &validator{}
+		v.checkDuration("watch.debounce", test.duration)
+		var got []string
+		for _, err := range v.errs {
+			got = append(got, err.Field+": "+err.Message)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("checkDuration(%q) = %q, want %q", test.duration, got, test.want)
+		}
+	}
+}
+
+func TestCheckEnum(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: ""},
+		{value: ImageValueFull},
+		{value: ImageValueSplit},
+		{value: ImageValueID},
+		{value: "digest", want: []string{`charts[0].images[0].imageValueFormat: unknown value "digest", must be one of full, split, id`}},
+	}
+	for _, test := range tests {
+		v := &validator{}
+		v.checkEnum("charts[0].images[0].imageValueFormat", "Image.ImageValueFormat", test.value)
+		var got []string
+		for _, err := range v.errs {
+			got = append(got, err.Field+": "+err.Message)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("checkEnum(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ChartValues merges the ValuesFiles of a chart in order and its inline
+// Values over them. Helm merges the result over the chart's own values.yaml.
+// The files are read every time so changes to them are picked up.
+func (c *GokuConfig) ChartValues(chart Chart) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, valuesFile := range chart.ValuesFiles {
+		fileValues, err := readValuesFile(filepath.Join(c.BaseDir, valuesFile))
+		if err != nil {
+			return nil, err
+		}
+		values = MergeValues(values, fileValues)
+	}
+	return MergeValues(values, chart.Values), nil
+}
+
+func readValuesFile(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read values file: %v", err)
+	}
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%s: yaml error: %v", path, err)
+	}
+	return values, nil
+}
+
+// MergeValues deep merges Helm values, with src taking precedence over dst.
+// Nested maps are merged key by key and anything else in src replaces the
+// value in dst. The result is a new map, dst and src are not modified.
+func MergeValues(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(dst)+len(src))
+	for key, value := range dst {
+		out[key] = value
+	}
+	for key, value := range src {
+		if existing, ok := out[key]; ok {
+			value = mergeValue(existing, value)
+		}
+		out[key] = value
+	}
+	return out
+}
+
+func mergeValue(dst interface{}, src interface{}) interface{} {
+	dstMap, dstOK := valuesMap(dst)
+	srcMap, srcOK := valuesMap(src)
+	if dstOK && srcOK {
+		return MergeValues(dstMap, srcMap)
+	}
+	return src
+}
+
+// valuesMap converts the map[interface{}]interface{} decoded by yaml to map[string]interface{}
+func valuesMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for key, v := range m {
+			out[fmt.Sprint(key)] = v
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// SetValue sets the value at a Helm value path such as image.tag, with the
+// escaping and list indices of helm --set: a\.b is the key "a.b" and
+// containers[0].image the image of the first container. The result is a deep
+// copy of values, which is not modified. Maps and lists are created along the
+// path as needed, replacing anything else in the way.
+func SetValue(values map[string]interface{}, path string, value interface{}) (map[string]interface{}, error) {
+	segments, err := splitValuePath(path)
+	if err != nil {
+		return nil, err
+	}
+	root, _ := valuesMap(copyValue(values))
+	if root == nil {
+		root = make(map[string]interface{})
+	}
+	return setPath(root, segments, value).(map[string]interface{}), nil
+}
+
+// ValidValuePath reports a Helm value path which SetValue can't parse
+func ValidValuePath(path string) error {
+	_, err := splitValuePath(path)
+	return err
+}
+
+// splitValuePath splits a value path into string keys and int list indices.
+// The first segment is always a key.
+func splitValuePath(path string) ([]interface{}, error) {
+	var segments []interface{}
+	var key bytes.Buffer
+	// a segment was just closed by ] so the key may be empty
+	afterIndex := false
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 == len(path) {
+				return nil, fmt.Errorf("value path %q ends with an escape", path)
+			}
+			i++
+			key.WriteByte(path[i])
+			afterIndex = false
+		case '.':
+			if key.Len() == 0 && !afterIndex {
+				return nil, fmt.Errorf("value path %q has an empty key", path)
+			}
+			if key.Len() > 0 {
+				segments = append(segments, key.String())
+				key.Reset()
+			}
+			afterIndex = false
+			if i+1 == len(path) {
+				return nil, fmt.Errorf("value path %q has an empty key", path)
+			}
+		case '[':
+			if key.Len() == 0 && !afterIndex {
+				return nil, fmt.Errorf("value path %q has a list index without a key", path)
+			}
+			if key.Len() > 0 {
+				segments = append(segments, key.String())
+				key.Reset()
+			}
+			end := i + 1
+			for end < len(path) && path[end] != ']' {
+				end++
+			}
+			if end == len(path) {
+				return nil, fmt.Errorf("value path %q has an unclosed [", path)
+			}
+			index, err := strconv.Atoi(path[i+1 : end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("value path %q has an invalid list index %q", path, path[i+1:end])
+			}
+			segments = append(segments, index)
+			i = end
+			afterIndex = true
+			if i+1 < len(path) && path[i+1] != '.' && path[i+1] != '[' {
+				return nil, fmt.Errorf("value path %q is missing a . after ]", path)
+			}
+		default:
+			key.WriteByte(c)
+			afterIndex = false
+		}
+	}
+	if key.Len() > 0 {
+		segments = append(segments, key.String())
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("value path is empty")
+	}
+	return segments, nil
+}
+
+func setPath(current interface{}, segments []interface{}, value interface{}) interface{} {
+	if len(segments) == 0 {
+		return value
+	}
+	switch segment := segments[0].(type) {
+	case int:
+		list, _ := current.([]interface{})
+		for len(list) <= segment {
+			list = append(list, nil)
+		}
+		list[segment] = setPath(list[segment], segments[1:], value)
+		return list
+	default:
+		m, ok := valuesMap(current)
+		if !ok {
+			m = make(map[string]interface{})
+		}
+		key := segment.(string)
+		m[key] = setPath(m[key], segments[1:], value)
+		return m
+	}
+}
+
+// copyValue deep copies the maps and lists of Helm values
+func copyValue(value interface{}) interface{} {
+	if m, ok := valuesMap(value); ok {
+		out := make(map[string]interface{}, len(m))
+		for key, v := range m {
+			out[key] = copyValue(v)
+		}
+		return out
+	}
+	if list, ok := value.([]interface{}); ok {
+		out := make([]interface{}, len(list))
+		for i, v := range list {
+			out[i] = copyValue(v)
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitValuePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		segments []interface{}
+		err      bool
+	}{
+		{"image", []interface{}{"image"}, false},
+		{"image.tag", []interface{}{"image", "tag"}, false},
+		{`annotations.goku\.io/digest`, []interface{}{"annotations", "goku.io/digest"}, false},
+		{`a\\b`, []interface{}{`a\b`}, false},
+		{"containers[0].image", []interface{}{"containers", 0, "image"}, false},
+		{"matrix[1][2]", []interface{}{"matrix", 1, 2}, false},
+		{"", nil, true},
+		{".image", nil, true},
+		{"image.", nil, true},
+		{"image..tag", nil, true},
+		{`image\`, nil, true},
+		{"[0].image", nil, true},
+		{"containers[0", nil, true},
+		{"containers[-1]", nil, true},
+		{"containers[x]", nil, true},
+		{"containers[0]image", nil, true},
+	}
+	for _, test := range tests {
+		segments, err := splitValuePath(test.path)
+		if (err != nil) != test.err {
+			t.Errorf("splitValuePath(%q) error = %v, want error %v", test.path, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, test.segments) {
+			t.Errorf("splitValuePath(%q) = %#v, want %#v", test.path, segments, test.segments)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	values := map[string]interface{}{
+		"image":      map[string]interface{}{"repository": "web", "tag": "latest"},
+		"containers": []interface{}{map[string]interface{}{"name": "web"}},
+		"replicas":   1,
+	}
+	tests := []struct {
+		path string
+		want map[string]interface{}
+	}{
+		{"image.tag", map[string]interface{}{
+			"image":      map[string]interface{}{"repository": "web", "tag": "v1"},
+			"containers": []interface{}{map[string]interface{}{"name": "web"}},
+			"replicas":   1,
+		}},
+		{"containers[1].image", map[string]interface{}{
+			"image":      map[string]interface{}{"repository": "web", "tag": "latest"},
+			"containers": []interface{}{map[string]interface{}{"name": "web"}, map[string]interface{}{"image": "v1"}},
+			"replicas":   1,
+		}},
+		{"replicas.image", map[string]interface{}{
+			"image":      map[string]interface{}{"repository": "web", "tag": "latest"},
+			"containers": []interface{}{map[string]interface{}{"name": "web"}},
+			"replicas":   map[string]interface{}{"image": "v1"},
+		}},
+	}
+	for _, test := range tests {
+		got, err := SetValue(values, test.path, "v1")
+		if err != nil {
+			t.Errorf("SetValue(%q) failed: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SetValue(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+	if tag := values["image"].(map[string]interface{})["tag"]; tag != "latest" {
+		t.Errorf("SetValue modified its values, image.tag = %v", tag)
+	}
+}
+
+func TestChartValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"values-base.yaml":  "replicas: 1\nimage:\n  pullPolicy: Always\n  tag: base\ncontainers:\n- name: app\n  image: nginx\n- name: sidecar\n",
+		"values-local.yaml": "image:\n  pullPolicy: Never\nresources: {}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &GokuConfig{BaseDir: dir}
+	chart := Chart{
+		Name:        "app",
+		ValuesFiles: []string{"values-base.yaml", "values-local.yaml"},
+		Values:      map[string]interface{}{"replicas": 2, "image": map[string]interface{}{"tag": "inline"}},
+	}
+
+	values, err := c.ChartValues(chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// later files and then the inline values take precedence, lists are replaced whole
+	want := map[string]interface{}{
+		"replicas":  2,
+		"image":     map[string]interface{}{"pullPolicy": "Never", "tag": "inline"},
+		"resources": map[interface{}]interface{}{},
+		"containers": []interface{}{
+			map[interface{}]interface{}{"name": "app", "image": "nginx"},
+			map[interface{}]interface{}{"name": "sidecar"},
+		},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("ChartValues() = %#v, want %#v", values, want)
+	}
+
+	// images are set over the result at their value path
+	values, err = SetValue(values, "containers[1].image", "goku/sidecar:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := values["containers"].([]interface{})
+	if len(containers) != 2 || !reflect.DeepEqual(containers[1], map[string]interface{}{"name": "sidecar", "image": "goku/sidecar:1"}) {
+		t.Errorf("SetValue() over ChartValues() gave containers %v", containers)
+	}
+
+	chart.ValuesFiles = append(chart.ValuesFiles, "missing.yaml")
+	if _, err := c.ChartValues(chart); err == nil {
+		t.Error("ChartValues() with a missing values file succeeded")
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CurrentVersion of the goku.yaml format, written as apiVersion
+const CurrentVersion = "goku/v1"
+
+// legacyVersion is the format of goku.yaml files written before apiVersion
+const legacyVersion = ""
+
+// converter upgrades a goku.yaml document from one format version to the
+// next. Converters edit the YAML line by line so comments are kept.
+type converter struct {
+	from    string
+	to      string
+	convert func(lines []string) ([]string, error)
+}
+
+// converters from each version to the next, oldest first
+var converters = []converter{
+	{from: legacyVersion, to: "goku/v1", convert: setAPIVersion("goku/v1")},
+}
+
+// Version reads the apiVersion of a goku.yaml document
+func Version(data []byte) (string, error) {
+	var header struct {
+		APIVersion string `yaml:"apiVersion"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return "", err
+	}
+	return header.APIVersion, nil
+}
+
+// Migrate converts a goku.yaml document to CurrentVersion, keeping its
+// comments. The version the document was written in is returned with it.
+func Migrate(data []byte) ([]byte, string, error) {
+	version, err := Version(data)
+	if err != nil {
+		return nil, "", err
+	}
+	from := version
+
+	lines := strings.Split(string(data), "\n")
+	for version != CurrentVersion {
+		converted := false
+		for _, c := range converters {
+			if c.from != version {
+				continue
+			}
+			if lines, err = c.convert(lines); err != nil {
+				return nil, from, fmt.Errorf("could not convert %s to %s: %v", versionName(c.from), c.to, err)
+			}
+			version, converted = c.to, true
+			break
+		}
+		if !converted {
+			return nil, from, fmt.Errorf("unsupported apiVersion %q, this goku supports up to %s", version, CurrentVersion)
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), from, nil
+}
+
+func versionName(version string) string {
+	if version == legacyVersion {
+		return "the legacy format"
+	}
+	return version
+}
+
+// setAPIVersion returns a converter which sets the top level apiVersion key,
+// adding it at the top of the document when it is missing
+func setAPIVersion(version string) func([]string) ([]string, error) {
+	return func(lines []string) ([]string, error) {
+		line := "apiVersion: " + version
+		for i, l := range lines {
+			if strings.HasPrefix(l, "apiVersion:") {
+				out := append([]string(nil), lines...)
+				out[i] = line
+				return out, nil
+			}
+		}
+
+		at := 0
+		if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+			at = 1
+		}
+		out := append([]string(nil), lines[:at]...)
+		out = append(out, line)
+		if at < len(lines) && strings.TrimSpace(lines[at]) != "" {
+			out = append(out, "")
+		}
+		return append(out, lines[at:]...), nil
+	}
+}
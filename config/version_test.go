@@ -0,0 +1,83 @@
+package config
+
+import "testing"
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+		from string
+		err  bool
+	}{
+		{
+			name: "legacy",
+			data: "# my project\ncharts:\n- name: app # the app\n  path: app\n",
+			want: "apiVersion: goku/v1\n\n# my project\ncharts:\n- name: app # the app\n  path: app\n",
+			from: "",
+		},
+		{
+			name: "legacy document start",
+			data: "---\ncharts: []\n",
+			want: "---\napiVersion: goku/v1\n\ncharts: []\n",
+			from: "",
+		},
+		{
+			name: "legacy starting with a blank line",
+			data: "\ncharts: []\n",
+			want: "apiVersion: goku/v1\n\ncharts: []\n",
+			from: "",
+		},
+		{
+			name: "empty",
+			data: "",
+			want: "apiVersion: goku/v1\n",
+			from: "",
+		},
+		{
+			name: "current",
+			data: "apiVersion: goku/v1\ncharts: []\n",
+			want: "apiVersion: goku/v1\ncharts: []\n",
+			from: "goku/v1",
+		},
+		{
+			name: "newer",
+			data: "apiVersion: goku/v9\n",
+			from: "goku/v9",
+			err:  true,
+		},
+		{
+			name: "invalid YAML",
+			data: "charts: [\n",
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		got, from, err := Migrate([]byte(test.data))
+		if (err != nil) != test.err {
+			t.Errorf("%s: Migrate() error = %v, want error %v", test.name, err, test.err)
+			continue
+		}
+		if from != test.from {
+			t.Errorf("%s: Migrate() from = %q, want %q", test.name, from, test.from)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: Migrate() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMigrateReadsBack(t *testing.T) {
+	data := "charts:\n- name: app\n  path: app\n  images:\n  - name: goku/app\n    imageValueName: image\n    path: app\n"
+	migrated, _, err := Migrate([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := Version(migrated); err != nil || version != CurrentVersion {
+		t.Errorf("Version() of the migrated document = %q, %v, want %q", version, err, CurrentVersion)
+	}
+	again, from, err := Migrate(migrated)
+	if err != nil || from != CurrentVersion || string(again) != string(migrated) {
+		t.Errorf("migrating again = %q, %q, %v, want it unchanged", again, from, err)
+	}
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fatih/color"
+	"github.com/timatooth/goku/config"
+)
+
+// BuiltImage is an image built and tagged by goku
+type BuiltImage struct {
+	// Image name (repository)
+	Name string
+	// Tag goku gave the image
+	Tag string
+	// Image ID, such as sha256:...
+	ID string
+	// SHA-256 digest of the build context with file times and owners left out
+	ContextDigest string
+}
+
+// Reference to the image by name and tag
+func (b BuiltImage) Reference() string {
+	return b.Name + ":" + b.Tag
+}
+
+// Build docker image inside local kubernetes node and return it with its new tag
+func (e *Engine) Build(ctx context.Context, image config.Image) (BuiltImage, error) {
+	builder, err := newBuilder(image)
+	if err != nil {
+		return BuiltImage{}, err
+	}
+	// inspects images whichever builder builds them
+	cli, err := newDockerClient(nil)
+	if err != nil {
+		return BuiltImage{}, fmt.Errorf("could not connect to docker: %v", err)
+	}
+	defer cli.Close()
+
+	contextPath, dockerFile := imageContext(image)
+	excludes, err := contextExcludes(e.path(contextPath), dockerFile)
+	if err != nil {
+		return BuiltImage{}, err
+	}
+	contextWriter := newContextWriter(e.path(contextPath), excludes, e.Config.Build.ReproducibleContext, e.path(CacheDir))
+	contextDigest, err := contextWriter.digest(e.hashes)
+	if err != nil {
+		return BuiltImage{}, err
+	}
+	log.Printf("Build context %s has digest %s", contextPath, contextDigest)
+	key := buildKey(image, dockerFile, e.tagPolicy(image), contextDigest)
+	if cached, ok := e.cachedImage(ctx, cli, image, key); ok {
+		log.Printf("Reusing image %s, nothing it is built from changed", cached.Reference())
+		cached.ContextDigest = contextDigest
+		return cached, nil
+	}
+
+	release, err := e.builds.slot(ctx, image.Name)
+	if err != nil {
+		return BuiltImage{}, err
+	}
+	defer release()
+
+	tag, err := e.tag(ctx, image, e.path(contextPath), key)
+	if err != nil {
+		return BuiltImage{}, err
+	}
+	built := BuiltImage{Name: image.Name, Tag: tag, ContextDigest: contextDigest}
+	log.Printf("Building %s with the %s builder", built.Reference(), builderName(image))
+	imageID, err := builder.Build(ctx, BuildRequest{
+		Image:       image,
+		Reference:   built.Reference(),
+		Tag:         built.Tag,
+		ContextPath: e.path(contextPath),
+		Dockerfile:  dockerFile,
+		Context:     contextWriter,
+		Compress:    e.Config.Build.CompressContext,
+		Verbose:     e.Verbose,
+	})
+	if err != nil {
+		return BuiltImage{}, fmt.Errorf("unable to build docker image %s: %v", image.Name, err)
+	}
+
+	// also checks that builders other than the docker API created the image
+	if imageID == "" {
+		inspect, _, err := cli.ImageInspectWithRaw(ctx, built.Reference())
+		if err != nil {
+			return BuiltImage{}, fmt.Errorf("image %s was not built: %v", built.Reference(), err)
+		}
+		imageID = inspect.ID
+	}
+	built.ID = imageID
+
+	if e.cache != nil {
+		entry := cacheEntry{Name: built.Name, Tag: built.Tag, ID: built.ID, Built: time.Now()}
+		if err := e.cache.put(key, entry); err != nil {
+			log.Printf("Could not save build cache: %v", err)
+		}
+	}
+	return built, nil
+}
+
+// apiBuilder builds images with the docker API
+type apiBuilder struct{}
+
+func (apiBuilder) Build(ctx context.Context, req BuildRequest) (string, error) {
+	image := req.Image
+	buildQuery := url.Values{}
+	if image.Target != "" {
+		buildQuery.Set("target", image.Target)
+	}
+	cli, err := newDockerClient(buildQuery)
+	if err != nil {
+		return "", fmt.Errorf("could not connect to docker: %v", err)
+	}
+	defer cli.Close()
+
+	buildContext := tarContext(req.Context, req.Compress)
+	// stops the walk if docker doesn't read the whole context
+	defer buildContext.Close()
+
+	imageBuildResponse, err := cli.ImageBuild(
+		ctx,
+		buildContext,
+		types.ImageBuildOptions{
+			Tags:        req.Tags(),
+			Context:     buildContext,
+			Dockerfile:  req.Dockerfile,
+			BuildArgs:   buildArgs(image.BuildArgs),
+			Labels:      image.Labels,
+			NetworkMode: image.Network,
+			NoCache:     image.NoCache,
+			Remove:      true})
+	if err != nil {
+		// the context may have failed first, otherwise stop sending it
+		buildContext.Close()
+		if contextErr := buildContext.Wait(); contextErr != nil {
+			return "", contextErr
+		}
+		return "", err
+	}
+	defer imageBuildResponse.Body.Close()
+	imageID, err := readBuildOutput(imageBuildResponse.Body, color.Output, "["+image.Name+"] ", req.Verbose)
+	buildContext.Close()
+	if contextErr := buildContext.Wait(); contextErr != nil {
+		return "", contextErr
+	}
+	// docker daemons before API 1.30 don't send the image ID, Build inspects the image instead
+	return imageID, err
+}
+
+// cachedImage finds an image built from the same context and options which
+// docker still has. Images with noCache are always built.
+func (e *Engine) cachedImage(ctx context.Context, cli *dockerClient, image config.Image, key string) (BuiltImage, bool) {
+	if e.cache == nil || image.NoCache {
+		return BuiltImage{}, false
+	}
+	entry, ok := e.cache.get(key)
+	if !ok {
+		return BuiltImage{}, false
+	}
+	cached := BuiltImage{Name: entry.Name, Tag: entry.Tag, ID: entry.ID}
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, cached.Reference())
+	if err != nil || inspect.ID != entry.ID {
+		return BuiltImage{}, false
+	}
+	return cached, true
+}
+
+// imageContext returns the build context path and Dockerfile of an image
+func imageContext(image config.Image) (string, string) {
+	//if ContextPath is not given: use the watchPath (Path) instead
+	contextPath := image.Path
+	if image.ContextPath != "" {
+		contextPath = image.ContextPath
+	}
+	// if Dockerfile is not give assume its ContextPath/Dockerfile
+	dockerFile := image.Dockerfile
+	if dockerFile == "" {
+		dockerFile = "Dockerfile"
+	}
+	return contextPath, dockerFile
+}
+
+// buildArgs converts build args to the pointers docker expects, where nil
+// would take the value from the environment of the docker CLI
+func buildArgs(args map[string]string) map[string]*string {
+	if len(args) == 0 {
+		return nil
+	}
+	converted := make(map[string]*string, len(args))
+	for name, value := range args {
+		value := value
+		converted[name] = &value
+	}
+	return converted
+}
+
+// path joins a path from goku.yaml to the BaseDir
+func (e *Engine) path(relPath string) string {
+	return path.Join(e.Config.BaseDir, relPath)
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildArgs(t *testing.T) {
+	tests := []struct {
+		args map[string]string
+		want map[string]string
+	}{
+		{nil, nil},
+		{map[string]string{}, nil},
+		{map[string]string{"GO_VERSION": "1.10", "EMPTY": ""}, map[string]string{"GO_VERSION": "1.10", "EMPTY": ""}},
+	}
+	for _, test := range tests {
+		converted := buildArgs(test.args)
+		if test.want == nil {
+			if converted != nil {
+				t.Errorf("buildArgs(%v) = %v, want nil", test.args, converted)
+			}
+			continue
+		}
+		got := make(map[string]string)
+		for name, value := range converted {
+			if value == nil {
+				t.Errorf("buildArgs(%v) left %s nil", test.args, name)
+				continue
+			}
+			got[name] = *value
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("buildArgs(%v) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
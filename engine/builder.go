@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/timatooth/goku/config"
+)
+
+// Builder builds the image of a goku.yaml image entry
+type Builder interface {
+	// Build the image tagged with every tag of req and return its ID, or an
+	// empty ID for Engine.Build to inspect the image instead
+	Build(ctx context.Context, req BuildRequest) (string, error)
+}
+
+// BuildRequest is an image for a Builder to build
+type BuildRequest struct {
+	Image config.Image
+	// name:tag goku tags the image with, and just its tag
+	Reference string
+	Tag       string
+	// Build context directory and Dockerfile relative to it
+	ContextPath string
+	Dockerfile  string
+	// Archives the build context for builders which send it themselves
+	Context *contextWriter
+	// Compress the build context
+	Compress bool
+	// Print the raw docker API output too
+	Verbose bool
+}
+
+// Tags the image is built with: its extra tags and Reference
+func (req BuildRequest) Tags() []string {
+	return append(append([]string(nil), req.Image.Tags...), req.Reference)
+}
+
+// newBuilder returns the Builder an image chose
+func newBuilder(image config.Image) (Builder, error) {
+	switch builderName(image) {
+	case config.BuilderDocker:
+		return apiBuilder{}, nil
+	case config.BuilderCLI:
+		return cliBuilder{}, nil
+	case config.BuilderBuildx:
+		return cliBuilder{buildx: true}, nil
+	case config.BuilderCommand:
+		return commandBuilder{}, nil
+	case config.BuilderGo:
+		return goBuilder{}, nil
+	}
+	return nil, fmt.Errorf("unknown builder %q for image %s", image.Builder, image.Name)
+}
+
+func builderName(image config.Image) string {
+	if image.Builder == "" {
+		return config.BuilderDocker
+	}
+	return image.Builder
+}
+
+// cliBuilder builds images by running docker build, or docker buildx build
+type cliBuilder struct {
+	buildx bool
+}
+
+func (b cliBuilder) Build(ctx context.Context, req BuildRequest) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", b.args(req)...)
+	// docker build reads the Dockerfile relative to the working directory
+	cmd.Dir = req.ContextPath
+	return "", runBuildCommand(cmd, req.Image.Name)
+}
+
+// args of the docker command building req
+func (b cliBuilder) args(req BuildRequest) []string {
+	image := req.Image
+	args := []string{"build"}
+	if b.buildx {
+		// buildx keeps images in its own cache unless they are loaded into docker
+		args = []string{"buildx", "build", "--load"}
+	}
+	for _, tag := range req.Tags() {
+		args = append(args, "--tag", tag)
+	}
+	args = append(args, "--file", req.Dockerfile)
+	if image.Target != "" {
+		args = append(args, "--target", image.Target)
+	}
+	for _, name := range sortedKeys(image.BuildArgs) {
+		args = append(args, "--build-arg", name+"="+image.BuildArgs[name])
+	}
+	for _, name := range sortedKeys(image.Labels) {
+		args = append(args, "--label", name+"="+image.Labels[name])
+	}
+	if image.Network != "" {
+		args = append(args, "--network", image.Network)
+	}
+	if image.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if req.Compress && !b.buildx {
+		args = append(args, "--compress")
+	}
+	return append(args, ".")
+}
+
+// commandBuilder builds images by running the command of an image, such as
+// bazel or jib, with IMAGE set to the name:tag to build and TAG to its tag.
+// Engine.Build checks that the command created the image.
+type commandBuilder struct{}
+
+func (commandBuilder) Build(ctx context.Context, req BuildRequest) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", req.Image.Command)
+	cmd.Dir = req.ContextPath
+	cmd.Env = append(os.Environ(),
+		"IMAGE="+req.Reference,
+		"IMAGE_NAME="+req.Image.Name,
+		"TAG="+req.Tag,
+		"BUILD_CONTEXT="+req.ContextPath,
+	)
+	if err := runBuildCommand(cmd, req.Image.Name); err != nil {
+		return "", err
+	}
+
+	// the extra tags are added here so commands only need to tag IMAGE
+	for _, tag := range req.Image.Tags {
+		tagCmd := exec.CommandContext(ctx, "docker", "tag", req.Reference, tag)
+		if out, err := tagCmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("could not tag %s as %s: %v: %s", req.Reference, tag, err, out)
+		}
+	}
+	return "", nil
+}
+
+// runBuildCommand runs a build command, printing its output with each line
+// starting with the image name
+func runBuildCommand(cmd *exec.Cmd, imageName string) error {
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			streamColor.Fprintf(color.Output, "[%s] %s\n", imageName, scanner.Text())
+		}
+		// keep reading so the command never blocks on a long line
+		io.Copy(ioutil.Discard, pr)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", cmd.Args[0], err)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/timatooth/goku/config"
+)
+
+func TestCLIBuilderArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder cliBuilder
+		req     BuildRequest
+		want    string
+	}{
+		{
+			name: "docker",
+			req:  BuildRequest{Image: config.Image{Name: "goku/app1"}, Reference: "goku/app1:1", Dockerfile: "Dockerfile"},
+			want: "build --tag goku/app1:1 --file Dockerfile .",
+		},
+		{
+			name: "every option",
+			req: BuildRequest{
+				Image: config.Image{
+					Name:      "goku/app1",
+					Tags:      []string{"goku/app1:dev", "registry.local/app1:dev"},
+					Target:    "dev",
+					BuildArgs: map[string]string{"VERSION": "1.2", "DEBUG": "true"},
+					Labels:    map[string]string{"team": "a", "app": "app1"},
+					Network:   "host",
+					NoCache:   true,
+				},
+				Reference:  "goku/app1:1",
+				Dockerfile: "docker/Dockerfile.dev",
+				Compress:   true,
+			},
+			want: "build --tag goku/app1:dev --tag registry.local/app1:dev --tag goku/app1:1 --file docker/Dockerfile.dev" +
+				" --target dev --build-arg DEBUG=true --build-arg VERSION=1.2 --label app=app1 --label team=a" +
+				" --network host --no-cache --compress .",
+		},
+		{
+			name:    "buildx",
+			builder: cliBuilder{buildx: true},
+			req:     BuildRequest{Image: config.Image{Name: "goku/app1"}, Reference: "goku/app1:1", Dockerfile: "Dockerfile", Compress: true},
+			want:    "buildx build --load --tag goku/app1:1 --file Dockerfile .",
+		},
+	}
+	for _, test := range tests {
+		if got := strings.Join(test.builder.args(test.req), " "); got != test.want {
+			t.Errorf("%s: args() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildRequestTags(t *testing.T) {
+	image := config.Image{Tags: []string{"goku/app1:dev"}}
+	req := BuildRequest{Image: image, Reference: "goku/app1:1"}
+	if got, want := req.Tags(), []string{"goku/app1:dev", "goku/app1:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %q, want %q", got, want)
+	}
+	if len(image.Tags) != 1 {
+		t.Errorf("Tags() changed the image tags to %q", image.Tags)
+	}
+}
+
+func TestNewBuilder(t *testing.T) {
+	tests := []struct {
+		builder string
+		want    Builder
+		wantErr bool
+	}{
+		{"", apiBuilder{}, false},
+		{config.BuilderDocker, apiBuilder{}, false},
+		{config.BuilderCLI, cliBuilder{}, false},
+		{config.BuilderBuildx, cliBuilder{buildx: true}, false},
+		{config.BuilderCommand, commandBuilder{}, false},
+		{config.BuilderGo, goBuilder{}, false},
+		{"kaniko", nil, true},
+	}
+	for _, test := range tests {
+		got, err := newBuilder(config.Image{Name: "goku/app1", Builder: test.builder})
+		if (err != nil) != test.wantErr {
+			t.Errorf("newBuilder(%q) error = %v, want error %v", test.builder, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("newBuilder(%q) = %#v, want %#v", test.builder, got, test.want)
+		}
+	}
+}
+
+func TestCommandBuilder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	req := BuildRequest{
+		Image:       config.Image{Name: "goku/app1", Command: `printf '%s %s %s %s %s' "$IMAGE" "$IMAGE_NAME" "$TAG" "$BUILD_CONTEXT" "$PWD" > build.out`},
+		Reference:   "goku/app1:1",
+		Tag:         "1",
+		ContextPath: dir,
+	}
+	if _, err := (commandBuilder{}).Build(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(dir + "/build.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "goku/app1:1 goku/app1 1 " + dir + " " + dir; string(out) != want {
+		t.Errorf("command ran with %q, want %q", out, want)
+	}
+
+	req.Image.Command = "exit 3"
+	if _, err := (commandBuilder{}).Build(context.Background(), req); err == nil {
+		t.Error("Build() of a failing command succeeded")
+	}
+}
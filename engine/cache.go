@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/timatooth/goku/config"
+)
+
+// CacheDir is where goku keeps its state, relative to the goku.yaml BaseDir.
+// It is never part of a build context.
+const CacheDir = ".goku"
+
+const buildCacheFile = "build-cache.json"
+
+// oldest entries are dropped when the cache grows past this
+const maxCacheEntries = 200
+
+// buildCache remembers the image built for each build context and its build
+// options, so images are only built when something they are built from changed
+type buildCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Name  string    `json:"name"`
+	Tag   string    `json:"tag"`
+	ID    string    `json:"id"`
+	Built time.Time `json:"built"`
+}
+
+// loadBuildCache reads the build cache from dir. A missing or unreadable
+// cache is empty.
+func loadBuildCache(dir string) *buildCache {
+	c := &buildCache{path: filepath.Join(dir, buildCacheFile), entries: make(map[string]cacheEntry)}
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Could not read build cache, images will be rebuilt: %v", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		log.Printf("Could not read build cache %s, images will be rebuilt: %v", c.path, err)
+		c.entries = make(map[string]cacheEntry)
+	}
+	return c
+}
+
+func (c *buildCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+// put adds an entry and saves the cache
+func (c *buildCache) put(key string, entry cacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	if len(c.entries) > maxCacheEntries {
+		keys := make([]string, 0, len(c.entries))
+		for k := range c.entries {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return c.entries[keys[i]].Built.Before(c.entries[keys[j]].Built)
+		})
+		for _, k := range keys[:len(keys)-maxCacheEntries] {
+			delete(c.entries, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	// write next to the cache and rename so it is never left half written
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), "."+buildCacheFile)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// buildKey identifies what an image is built from: its build context digest
+// and every option changing the image
+func buildKey(image config.Image, dockerFile string, tagPolicy string, contextDigest string) string {
+	options, _ := json.Marshal(struct {
+		Name       string
+		Tags       []string
+		Dockerfile string
+		BuildArgs  map[string]string
+		Target     string
+		Labels     map[string]string
+		Network    string
+		TagPolicy  string
+		Builder    string
+		Command    string
+		Go         config.GoBuild
+	}{image.Name, image.Tags, dockerFile, image.BuildArgs, image.Target, image.Labels, image.Network, tagPolicy,
+		image.Builder, image.Command, image.Go})
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(append([]byte(contextDigest+"\n"), options...)))
+}
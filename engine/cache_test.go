@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/timatooth/goku/config"
+)
+
+func TestBuildCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, CacheDir)
+
+	c := loadBuildCache(cacheDir)
+	if _, ok := c.get("sha256:1"); ok {
+		t.Error("get() from a missing cache found an entry")
+	}
+	entry := cacheEntry{Name: "goku/app1", Tag: "1", ID: "sha256:abc", Built: time.Now().Round(0)}
+	if err := c.put("sha256:1", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := loadBuildCache(cacheDir)
+	got, ok := loaded.get("sha256:1")
+	if !ok || got.Name != entry.Name || got.Tag != entry.Tag || got.ID != entry.ID || !got.Built.Equal(entry.Built) {
+		t.Errorf("get() after loading the saved cache = %+v, %v, want %+v", got, ok, entry)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, buildCacheFile), []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadBuildCache(cacheDir).get("sha256:1"); ok {
+		t.Error("get() from an unreadable cache found an entry")
+	}
+}
+
+func TestBuildCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := loadBuildCache(dir)
+	start := time.Now()
+	for i := 0; i <= maxCacheEntries; i++ {
+		entry := cacheEntry{Name: "goku/app1", Tag: fmt.Sprint(i), Built: start.Add(time.Duration(i) * time.Second)}
+		if err := c.put(fmt.Sprint("key", i), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded := loadBuildCache(dir)
+	if len(loaded.entries) != maxCacheEntries {
+		t.Errorf("cache kept %d entries, want %d", len(loaded.entries), maxCacheEntries)
+	}
+	if _, ok := loaded.get("key0"); ok {
+		t.Error("the oldest entry was kept")
+	}
+	if _, ok := loaded.get(fmt.Sprint("key", maxCacheEntries)); !ok {
+		t.Error("the newest entry was dropped")
+	}
+}
+
+func TestBuildKey(t *testing.T) {
+	image := config.Image{
+		Name:      "goku/app1",
+		BuildArgs: map[string]string{"VERSION": "1"},
+		Labels:    map[string]string{"team": "a"},
+	}
+	key := buildKey(image, "Dockerfile", "", "sha256:context")
+	if again := buildKey(image, "Dockerfile", "", "sha256:context"); again != key {
+		t.Errorf("buildKey() of the same image = %q, then %q", key, again)
+	}
+
+	tests := []struct {
+		name       string
+		change     func(image *config.Image)
+		dockerFile string
+		tagPolicy  string
+		digest     string
+	}{
+		{"context", func(image *config.Image) {}, "Dockerfile", "", "sha256:changed"},
+		{"dockerfile", func(image *config.Image) {}, "Dockerfile.dev", "", "sha256:context"},
+		{"name", func(image *config.Image) { image.Name = "goku/app2" }, "Dockerfile", "", "sha256:context"},
+		{"tags", func(image *config.Image) { image.Tags = []string{"goku/app1:dev"} }, "Dockerfile", "", "sha256:context"},
+		{"build args", func(image *config.Image) { image.BuildArgs = map[string]string{"VERSION": "2"} }, "Dockerfile", "", "sha256:context"},
+		{"target", func(image *config.Image) { image.Target = "dev" }, "Dockerfile", "", "sha256:context"},
+		{"labels", func(image *config.Image) { image.Labels = nil }, "Dockerfile", "", "sha256:context"},
+		{"network", func(image *config.Image) { image.Network = "host" }, "Dockerfile", "", "sha256:context"},
+		{"tag policy", func(image *config.Image) {}, "Dockerfile", config.TagGitCommit, "sha256:context"},
+		{"builder", func(image *config.Image) { image.Builder = config.BuilderBuildx }, "Dockerfile", "", "sha256:context"},
+		{"command", func(image *config.Image) { image.Command = "make image" }, "Dockerfile", "", "sha256:context"},
+		{"go", func(image *config.Image) { image.Go.Flags = []string{"-race"} }, "Dockerfile", "", "sha256:context"},
+	}
+	for _, test := range tests {
+		changed := image
+		test.change(&changed)
+		if got := buildKey(changed, test.dockerFile, test.tagPolicy, test.digest); got == key {
+			t.Errorf("%s: buildKey() did not change", test.name)
+		}
+	}
+
+	// rebuilding without the docker layer cache gives the same image
+	noCache := image
+	noCache.NoCache = true
+	if got := buildKey(noCache, "Dockerfile", "", "sha256:context"); got != key {
+		t.Errorf("buildKey() with noCache = %q, want %q", got, key)
+	}
+}
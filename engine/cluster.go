@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/fatih/color"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// SetupMinikubeDockerEnv points the docker client at the docker daemon inside
+// the minikube VM by setting the variables printed by minikube docker-env
+func SetupMinikubeDockerEnv() error {
+	out, err := exec.Command("minikube", "docker-env").Output()
+	if err != nil {
+		return fmt.Errorf("minikube docker-env failed: %v", err)
+	}
+	s := string(out[:])
+	lines := strings.Split(s, "\n")
+	for _, line := range lines {
+		l := strings.Replace(line, "export ", "", 1)
+		if len(l) > 1 && string(l[0]) != string("#") {
+			dockerEnvKeys := strings.SplitN(l, "=", 2)
+			if len(dockerEnvKeys) != 2 {
+				continue
+			}
+			os.Setenv(dockerEnvKeys[0], strings.Replace(dockerEnvKeys[1], "\"", "", 2))
+		}
+	}
+	return nil
+}
+
+// MinikubeIP is the IP address of the minikube VM
+func MinikubeIP() (string, error) {
+	out, err := exec.Command("minikube", "ip").Output()
+	if err != nil {
+		return "", fmt.Errorf("minikube ip failed: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// PortForwardTiller runs kubectl port-forward in the background so Tiller can
+// be reached on DefaultTillerHost. The port-forward stops when ctx is done.
+func PortForwardTiller(ctx context.Context, kubeconfig string) error {
+	defer color.Unset()
+	color.Set(color.FgGreen)
+
+	// use the current context in kubeconfig
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	pods, err := clientset.CoreV1().Pods("kube-system").List(metav1.ListOptions{LabelSelector: "app=helm"})
+	if err != nil || len(pods.Items) < 1 {
+		return fmt.Errorf("could NOT find tiller pod installed in the cluster: %v", err)
+	}
+	tillerPodName := pods.Items[0].ObjectMeta.Name
+	log.Printf("Port-forwarding %s", tillerPodName)
+
+	//run a kubectl port-forward command in the background so we can interact with helm in the cluster.
+	command := exec.CommandContext(ctx, "kubectl", "-n", "kube-system", "port-forward", tillerPodName, "44134")
+
+	//TODO make this formatted better.
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("port-forward exec failed with %s", err)
+	}
+	go command.Wait()
+	return nil
+}
@@ -0,0 +1,319 @@
+package engine
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/timatooth/goku/ignore"
+)
+
+// Build contexts bigger than this are usually missing a .dockerignore entry
+const largeContextSize = 100 * 1000 * 1000
+
+// contextExcludes reads the .dockerignore of a build context. Like docker
+// build the Dockerfile and .dockerignore are always sent.
+func contextExcludes(contextPath string, dockerFile string) (*ignore.Matcher, error) {
+	excludes, err := ignore.ReadDockerignore(contextPath)
+	if err != nil {
+		return nil, err
+	}
+	return excludes.Keep(dockerFile, ignore.DockerignoreFile), nil
+}
+
+// contextStream is a docker build context archived while it is read
+type contextStream struct {
+	*io.PipeReader
+	done    chan struct{}
+	err     error
+	stop    sync.Once
+	stopped chan struct{}
+}
+
+// Close stops archiving, which is not reported as an error by Wait
+func (s *contextStream) Close() error {
+	s.stop.Do(func() { close(s.stopped) })
+	return s.PipeReader.Close()
+}
+
+// Wait until the archive is written and return the error it failed with
+func (s *contextStream) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// contextWriter archives every file below contextPath which is not excluded
+// as a docker build context
+type contextWriter struct {
+	contextPath string
+	excludes    *ignore.Matcher
+	// normalize the archive so the same files always give the same bytes
+	reproducible bool
+	// directory below contextPath never archived, such as the CacheDir
+	skipDir string
+
+	// files and bytes of file content in the last archive written
+	files  int
+	size   int64
+	warned bool
+}
+
+func newContextWriter(contextPath string, excludes *ignore.Matcher, reproducible bool, skipDir string) *contextWriter {
+	return &contextWriter{contextPath: contextPath, excludes: excludes, reproducible: reproducible, skipDir: skipDir}
+}
+
+// walk calls fn with the tar header of every file archived, skipping the
+// excluded paths before they are opened. filepath.Walk visits files in
+// lexical order, so the entries are always in the same order.
+func (c *contextWriter) walk(fn func(path string, h *tar.Header, info os.FileInfo) error) error {
+	return filepath.Walk(c.contextPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		newPath, err := filepath.Rel(c.contextPath, path)
+		if err != nil {
+			return err
+		}
+		if newPath != "." && c.excludes.Excludes(newPath) {
+			if info.IsDir() && c.excludes.SkipDir(newPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if filepath.Clean(path) == filepath.Clean(c.skipDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		h, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("couldn't create tar header for %s: %v", path, err)
+		}
+		// We need to convert ToSlash if the OS is Windows
+		// make sure the path slashes are around the right way!
+		h.Name = filepath.ToSlash(newPath)
+		return fn(path, h, info)
+	})
+}
+
+// write the archive to w, normalized with normalizeHeader if normalize is set
+func (c *contextWriter) write(w io.Writer, normalize bool) error {
+	c.files, c.size = 0, 0
+	tw := tar.NewWriter(w)
+
+	err := c.walk(func(path string, h *tar.Header, info os.FileInfo) error {
+		if normalize {
+			normalizeHeader(h)
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return fmt.Errorf("error writing tar header for %s: %v", path, err)
+		}
+		c.files++
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		aFile, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("unable to open %s: %v", path, err)
+		}
+		defer aFile.Close()
+		if _, err := io.Copy(tw, aFile); err != nil {
+			return fmt.Errorf("error copying %s to tar: %v", path, err)
+		}
+
+		c.size += info.Size()
+		if c.size > largeContextSize && !c.warned {
+			c.warned = true
+			color.Yellow("Build context %s is over %s, is its .dockerignore missing something?", c.contextPath, byteSize(largeContextSize))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// normalizeHeader clears the times and owner of an archived file and keeps
+// only whether it is executable of its permissions
+func normalizeHeader(h *tar.Header) {
+	h.ModTime = time.Unix(0, 0)
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+	h.Uid, h.Gid = 0, 0
+	h.Uname, h.Gname = "", ""
+	h.Format = tar.FormatPAX
+	if h.Typeflag == tar.TypeSymlink {
+		h.Mode = 0777
+	} else if h.Mode&0111 != 0 {
+		h.Mode = 0755
+	} else {
+		h.Mode = 0644
+	}
+}
+
+// fileHashes remembers the content hashes of the files of each build
+// context, so digests only read the files changed since the last digest
+type fileHashes struct {
+	mu sync.Mutex
+	// by build context path and file path
+	contexts map[string]map[string]fileHash
+}
+
+// fileHash is the content hash of a file and the stat info it was hashed with
+type fileHash struct {
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	hashed  time.Time
+	sum     []byte
+}
+
+func newFileHashes() *fileHashes {
+	return &fileHashes{contexts: make(map[string]map[string]fileHash)}
+}
+
+// unchanged reports if a file hashed before still has the same stat info.
+// Files modified within a second of being hashed are hashed again, as they
+// could have changed since without their modification time changing.
+func (h fileHash) unchanged(info os.FileInfo) bool {
+	return h.sum != nil && h.size == info.Size() && h.mode == info.Mode() &&
+		h.modTime.Equal(info.ModTime()) && h.modTime.Before(h.hashed.Add(-time.Second))
+}
+
+// digest of the build context, which only depends on the names, contents
+// and executable bits of the files archived. Files are read unless hashes
+// holds their hash with the same stat info, and read again when the context
+// is sent to docker.
+func (c *contextWriter) digest(hashes *fileHashes) (string, error) {
+	var previous map[string]fileHash
+	if hashes != nil {
+		hashes.mu.Lock()
+		previous = hashes.contexts[c.contextPath]
+		hashes.mu.Unlock()
+	}
+	seen := make(map[string]fileHash)
+
+	hash := sha256.New()
+	err := c.walk(func(path string, h *tar.Header, info os.FileInfo) error {
+		normalizeHeader(h)
+		fmt.Fprintf(hash, "%s\x00%c\x00%o\x00%s\x00%d\x00", h.Name, h.Typeflag, h.Mode, h.Linkname, h.Size)
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, ok := previous[path]
+		if !ok || !file.unchanged(info) {
+			file = fileHash{size: info.Size(), mode: info.Mode(), modTime: info.ModTime(), hashed: time.Now()}
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("unable to open %s: %v", path, err)
+			}
+			defer f.Close()
+			fileSum := sha256.New()
+			if _, err := io.Copy(fileSum, f); err != nil {
+				return fmt.Errorf("unable to read %s: %v", path, err)
+			}
+			file.sum = fileSum.Sum(nil)
+		}
+		seen[path] = file
+		hash.Write(file.sum)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create build context: %v", err)
+	}
+
+	if hashes != nil {
+		hashes.mu.Lock()
+		hashes.contexts[c.contextPath] = seen
+		hashes.mu.Unlock()
+	}
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil)), nil
+}
+
+// tarContext streams the build context written by c. Files are walked as the
+// archive is read, with gzip compression if compress is set. Close the
+// stream to stop the walk early.
+func tarContext(c *contextWriter, compress bool) *contextStream {
+	pr, pw := io.Pipe()
+	stream := &contextStream{PipeReader: pr, done: make(chan struct{}), stopped: make(chan struct{})}
+
+	go func() {
+		defer close(stream.done)
+		sent := &countingWriter{w: pw}
+		var w io.Writer = sent
+		var gz *gzip.Writer
+		if compress {
+			gz = gzip.NewWriter(sent)
+			w = gz
+		}
+
+		err := c.write(w, c.reproducible)
+		if err == nil && gz != nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			select {
+			case <-stream.stopped:
+			default:
+				stream.err = fmt.Errorf("could not create build context: %v", err)
+				pw.CloseWithError(stream.err)
+			}
+			return
+		}
+		pw.Close()
+
+		if compress {
+			log.Printf("Sent build context %s: %s in %d files, %s compressed", c.contextPath, byteSize(c.size), c.files, byteSize(sent.n))
+		} else {
+			log.Printf("Sent build context %s: %s in %d files", c.contextPath, byteSize(c.size), c.files)
+		}
+	}()
+	return stream
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// byteSize formats a number of bytes for people to read
+func byteSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "kB"
+	for _, next := range []string{"MB", "GB", "TB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timatooth/goku/ignore"
+)
+
+// writeFiles creates files with their content below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTar returns the content of each file in a tar archive by name
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(content)
+	}
+}
+
+func TestTarContext(t *testing.T) {
+	files := map[string]string{
+		"Dockerfile":         "FROM scratch\n",
+		"main.go":            "package main\n",
+		"main_test.go":       "package main\n",
+		"static/css/app.css": "body {}\n",
+		"node_modules/a.js":  "module.exports = {}\n",
+		"empty":              "",
+	}
+	tests := []struct {
+		dockerignore string
+		want         []string
+	}{
+		{"", []string{"Dockerfile", "empty", "main.go", "main_test.go", "node_modules/a.js", "static/css/app.css"}},
+		{"node_modules\n*_test.go\n", []string{".dockerignore", "Dockerfile", "empty", "main.go", "static/css/app.css"}},
+		{"*\n!main.go\n", []string{".dockerignore", "Dockerfile", "main.go"}},
+		{"static\n!static/css\n", []string{".dockerignore", "Dockerfile", "empty", "main.go", "main_test.go", "node_modules/a.js", "static/css/app.css"}},
+		{"Dockerfile\n.dockerignore\n", []string{".dockerignore", "Dockerfile", "empty", "main.go", "main_test.go", "node_modules/a.js", "static/css/app.css"}},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "goku-context")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeFiles(t, dir, files)
+		if test.dockerignore != "" {
+			writeFiles(t, dir, map[string]string{".dockerignore": test.dockerignore})
+		}
+
+		excludes, err := contextExcludes(dir, "Dockerfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, compress := range []bool{false, true} {
+			stream := tarContext(newContextWriter(dir, excludes, false, ""), compress)
+			var r io.Reader = stream
+			if compress {
+				if r, err = gzip.NewReader(stream); err != nil {
+					t.Fatal(err)
+				}
+			}
+			archived := readTar(t, r)
+			if err := stream.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for name, content := range archived {
+				names = append(names, name)
+				if want, ok := files[name]; ok && content != want {
+					t.Errorf("%s was archived with %q, want %q", name, content, want)
+				}
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("with .dockerignore %q and compress %v tarContext() archived %v, want %v", test.dockerignore, compress, names, test.want)
+			}
+		}
+	}
+}
+
+func TestTarContextSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"config/app.yaml": "debug: true\n"})
+	if err := os.Symlink("config/app.yaml", filepath.Join(dir, "app.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := tarContext(newContextWriter(dir, &ignore.Matcher{}, false, ""), false)
+	tr := tar.NewReader(stream)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			t.Fatal("the symlink was not archived")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name == "app.yaml" {
+			if h.Typeflag != tar.TypeSymlink || h.Linkname != "config/app.yaml" {
+				t.Errorf("app.yaml was archived as type %c linking to %q, want a symlink to config/app.yaml", h.Typeflag, h.Linkname)
+			}
+			break
+		}
+	}
+	stream.Close()
+	if err := stream.Wait(); err != nil {
+		t.Errorf("Wait() after Close() = %v, want nil", err)
+	}
+}
+
+func TestTarContextClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"a": "a\n", "b": "b\n", "c": "c\n"})
+
+	// closing before anything was read stops the walk without an error
+	stream := tarContext(newContextWriter(dir, &ignore.Matcher{}, false, ""), true)
+	stream.Close()
+	if err := stream.Wait(); err != nil {
+		t.Errorf("Wait() after Close() = %v, want nil", err)
+	}
+}
+
+func TestTarContextError(t *testing.T) {
+	stream := tarContext(newContextWriter(filepath.Join(os.TempDir(), "goku-no-such-context"), &ignore.Matcher{}, false, ""), false)
+	if _, err := ioutil.ReadAll(stream); err == nil {
+		t.Error("reading the context of a missing directory succeeded")
+	}
+	if err := stream.Wait(); err == nil {
+		t.Error("Wait() of the context of a missing directory = nil, want an error")
+	}
+}
+
+func TestContextDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"Dockerfile":                        "FROM alpine\n",
+		"src/main.go":                       "package main\n",
+		"run.sh":                            "#!/bin/sh\n",
+		".goku/build-cache.json":            "{}\n",
+		".goku/nested/build-cache.json.tmp": "{}\n",
+	})
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	digest := func() string {
+		d, err := newContextWriter(dir, &ignore.Matcher{}, false, filepath.Join(dir, CacheDir)).digest(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	want := digest()
+	if !strings.HasPrefix(want, "sha256:") || len(want) != len("sha256:")+64 {
+		t.Errorf("digest() = %q, want sha256: and 64 hex digits", want)
+	}
+	if again := digest(); again != want {
+		t.Errorf("digest() of the same files = %q, then %q", want, again)
+	}
+
+	// times, permissions other than executable and the skipped directory are left out
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "src/main.go"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "Dockerfile"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{".goku/build-cache.json": "{\"changed\": true}\n"})
+	if got := digest(); got != want {
+		t.Errorf("digest() changed to %q after touching files, want %q", got, want)
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notExecutable := digest()
+	if notExecutable == want {
+		t.Error("digest() did not change when run.sh was no longer executable")
+	}
+	writeFiles(t, dir, map[string]string{"src/main.go": "package main // changed\n"})
+	changed := digest()
+	if changed == notExecutable {
+		t.Error("digest() did not change when src/main.go was changed")
+	}
+	if err := os.Rename(filepath.Join(dir, "src/main.go"), filepath.Join(dir, "src/app.go")); err != nil {
+		t.Fatal(err)
+	}
+	if got := digest(); got == changed {
+		t.Error("digest() did not change when src/main.go was renamed")
+	}
+}
+
+func TestContextDigestHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"a.txt": "aaaa\n", "b.txt": "bbbb\n"})
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newContextWriter(dir, &ignore.Matcher{}, false, "")
+	hashes := newFileHashes()
+	first, err := c.digest(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uncached, err := c.digest(nil); err != nil || uncached != first {
+		t.Fatalf("digest(nil) = %q, %v, want %q", uncached, err, first)
+	}
+
+	// a file with the same size, mode and time is not read again
+	writeFiles(t, dir, map[string]string{"a.txt": "AAAA\n"})
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.digest(hashes); err != nil || got != first {
+		t.Errorf("digest() of a file with the same stat info = %q, %v, want the remembered %q", got, err, first)
+	}
+	if got, err := c.digest(nil); err != nil || got == first {
+		t.Errorf("digest(nil) = %q, %v, want the changed contents read", got, err)
+	}
+
+	// a file with a new time is read again
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), old.Add(time.Minute), old.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	want, err := c.digest(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.digest(hashes); err != nil || got != want {
+		t.Errorf("digest() of a touched file = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestNormalizeHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeflag byte
+		mode     int64
+		wantMode int64
+	}{
+		{"file", tar.TypeReg, 0664, 0644},
+		{"private file", tar.TypeReg, 0600, 0644},
+		{"executable", tar.TypeReg, 0775, 0755},
+		{"owner executable", tar.TypeReg, 0700, 0755},
+		{"symlink", tar.TypeSymlink, 0755, 0777},
+	}
+	for _, test := range tests {
+		h := &tar.Header{
+			Name:       "app",
+			Typeflag:   test.typeflag,
+			Mode:       test.mode,
+			ModTime:    time.Now(),
+			AccessTime: time.Now(),
+			ChangeTime: time.Now(),
+			Uid:        1000,
+			Gid:        1000,
+			Uname:      "dev",
+			Gname:      "dev",
+		}
+		normalizeHeader(h)
+		if h.Mode != test.wantMode {
+			t.Errorf("%s: normalizeHeader() set mode %o, want %o", test.name, h.Mode, test.wantMode)
+		}
+		if !h.ModTime.Equal(time.Unix(0, 0)) || !h.AccessTime.IsZero() || !h.ChangeTime.IsZero() {
+			t.Errorf("%s: normalizeHeader() kept times %v, %v, %v", test.name, h.ModTime, h.AccessTime, h.ChangeTime)
+		}
+		if h.Uid != 0 || h.Gid != 0 || h.Uname != "" || h.Gname != "" {
+			t.Errorf("%s: normalizeHeader() kept owner %d:%d %s:%s", test.name, h.Uid, h.Gid, h.Uname, h.Gname)
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1000, "1.0 kB"},
+		{1500, "1.5 kB"},
+		{999999, "1000.0 kB"},
+		{1000000, "1.0 MB"},
+		{2500000000, "2.5 GB"},
+		{3000000000000000, "3000.0 TB"},
+	}
+	for _, test := range tests {
+		if got := byteSize(test.n); got != test.want {
+			t.Errorf("byteSize(%d) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
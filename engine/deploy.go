@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/timatooth/goku/config"
+	"gopkg.in/yaml.v2"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/helm"
+	hapichart "k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// ReleaseName of the Helm release goku manages for a chart
+func ReleaseName(chart config.Chart) string {
+	return "goku-" + chart.Name
+}
+
+// Deploy - Create or update Helm release with chart & value overrides.
+// Helm merges the values over the chart's values.yaml. Watch deploys the
+// chart's valuesFiles and inline values with the images it built set over them.
+func (e *Engine) Deploy(ctx context.Context, chart config.Chart, values map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	vals, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("could not marshal chart value overrides: %v", err)
+	}
+
+	chartPath := e.path(chart.Path)
+	log.Printf("Loading chart %s ...\n", chartPath)
+	achart, err := chartutil.Load(chartPath)
+	if err != nil {
+		return fmt.Errorf("could not load Helm chart %s: %v", chartPath, err)
+	}
+
+	hc := helm.NewClient(helm.Host(e.TillerHost), helm.ConnectTimeout(30))
+	releaseName := ReleaseName(chart)
+	exists, err := releaseExists(hc, releaseName)
+	if err != nil {
+		return err
+	}
+	// charts others depend on are only done once Tiller reports them ready
+	wait := len(e.dependents[chart.Name]) > 0
+	timeout := int64(e.ReadyTimeout / time.Second)
+	if !exists {
+		log.Printf("***Installing*** chart release %s... ", releaseName)
+		_, err = hc.InstallReleaseFromChart(achart, "default", helm.ReleaseName(releaseName), helm.ValueOverrides(vals),
+			helm.InstallWait(wait), helm.InstallTimeout(timeout))
+	} else {
+		log.Printf("**Updating** existing chart release %s... ", releaseName)
+		_, err = hc.UpdateReleaseFromChart(releaseName, achart, helm.UpdateValueOverrides(vals),
+			helm.UpgradeWait(wait), helm.UpgradeTimeout(timeout))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to install/update Helm chart %s: %v", chart.Name, err)
+	}
+	log.Println("Done")
+	return nil
+}
+
+// Check if goku managed release already been deployed
+func releaseExists(hc *helm.Client, name string) (bool, error) {
+	response, err := hc.ListReleases(helm.ReleaseListFilter(name))
+	if err != nil {
+		return false, fmt.Errorf("can't contact Tiller to list release %s, make sure helm init has been run and helm/tiller versions match: %v", name, err)
+	}
+	return response != nil && response.Count == 1, nil
+}
+
+// Released reports if the Helm release of a chart already runs the chart as
+// it is on disk with values, so deploying it again would change nothing
+func (e *Engine) Released(ctx context.Context, chart config.Chart, values map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	vals, err := yaml.Marshal(values)
+	if err != nil {
+		return false, fmt.Errorf("could not marshal chart value overrides: %v", err)
+	}
+	chartPath := e.path(chart.Path)
+	achart, err := chartutil.Load(chartPath)
+	if err != nil {
+		return false, fmt.Errorf("could not load Helm chart %s: %v", chartPath, err)
+	}
+	// the Helm client applies the requirements of a chart before sending it to Tiller
+	if err := chartutil.ProcessRequirementsEnabled(achart, &hapichart.Config{Raw: string(vals)}); err != nil {
+		return false, err
+	}
+	if err := chartutil.ProcessRequirementsImportValues(achart); err != nil {
+		return false, err
+	}
+
+	hc := helm.NewClient(helm.Host(e.TillerHost), helm.ConnectTimeout(30))
+	releaseName := ReleaseName(chart)
+	exists, err := releaseExists(hc, releaseName)
+	if err != nil || !exists {
+		return false, err
+	}
+	response, err := hc.ReleaseContent(releaseName)
+	if err != nil {
+		return false, fmt.Errorf("could not get the content of release %s: %v", releaseName, err)
+	}
+	rel := response.GetRelease()
+	if rel.GetInfo().GetStatus().GetCode() != release.Status_DEPLOYED || !proto.Equal(rel.GetChart(), achart) {
+		return false, nil
+	}
+	return sameValues(rel.GetConfig().GetRaw(), string(vals))
+}
+
+// sameValues reports if two YAML documents of chart values are equal
+func sameValues(a, b string) (bool, error) {
+	aValues, err := chartutil.ReadValues([]byte(a))
+	if err != nil {
+		return false, err
+	}
+	bValues, err := chartutil.ReadValues([]byte(b))
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aValues, bValues), nil
+}
@@ -0,0 +1,401 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timatooth/goku/config"
+)
+
+// fakeCluster builds and deploys instantly, recording what it deployed
+type fakeCluster struct {
+	failBuild  string
+	failDeploy string
+	// tag of the images built, 1 unless set
+	version string
+
+	mu sync.Mutex
+	// "start" and "done" events of each deploy, in order
+	events []string
+	values map[string]map[string]interface{}
+}
+
+// newFakeEngine returns an Engine which builds and deploys with a fakeCluster
+func newFakeEngine(charts []config.Chart) (*Engine, *fakeCluster) {
+	e := New(&config.GokuConfig{Charts: charts})
+	cluster := &fakeCluster{values: make(map[string]map[string]interface{})}
+	e.build = func(ctx context.Context, image config.Image) (BuiltImage, error) {
+		if image.Name == cluster.failBuild {
+			return BuiltImage{}, fmt.Errorf("build of %s failed", image.Name)
+		}
+		tag := "1"
+		if cluster.version != "" {
+			tag = cluster.version
+		}
+		return BuiltImage{Name: image.Name, Tag: tag, ID: "sha256:" + image.Name + ":" + tag}, nil
+	}
+	e.deploy = func(ctx context.Context, chart config.Chart, values map[string]interface{}) error {
+		cluster.record("start " + chart.Name)
+		// gives charts deployed too early a chance to overtake their dependencies
+		time.Sleep(5 * time.Millisecond)
+		if chart.Name == cluster.failDeploy {
+			return fmt.Errorf("deploy of %s failed", chart.Name)
+		}
+		cluster.mu.Lock()
+		cluster.values[chart.Name] = values
+		cluster.mu.Unlock()
+		cluster.record("done " + chart.Name)
+		return nil
+	}
+	e.released = func(ctx context.Context, chart config.Chart, values map[string]interface{}) (bool, error) {
+		cluster.mu.Lock()
+		defer cluster.mu.Unlock()
+		deployed, ok := cluster.values[chart.Name]
+		return ok && reflect.DeepEqual(deployed, values), nil
+	}
+	return e, cluster
+}
+
+func (c *fakeCluster) record(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *fakeCluster) index(event string) int {
+	for i, e := range c.events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+// deployed returns the charts deployed successfully, sorted
+func (c *fakeCluster) deployed() []string {
+	var names []string
+	for name := range c.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDeployAll(t *testing.T) {
+	image := func(name string) []config.Image {
+		return []config.Image{{Name: name, ImageValueName: "image", Path: name}}
+	}
+	tests := []struct {
+		name       string
+		charts     []config.Chart
+		failBuild  string
+		failDeploy string
+		deployed   []string
+		err        bool
+	}{
+		{
+			name: "independent",
+			charts: []config.Chart{
+				{Name: "api", Images: image("api")},
+				{Name: "web", Images: image("web")},
+			},
+			deployed: []string{"api", "web"},
+		},
+		{
+			name: "chain",
+			charts: []config.Chart{
+				{Name: "web", Images: image("web"), DependsOn: []string{"api"}},
+				{Name: "api", Images: image("api"), DependsOn: []string{"db"}},
+				{Name: "db"},
+			},
+			deployed: []string{"api", "db", "web"},
+		},
+		{
+			name: "diamond",
+			charts: []config.Chart{
+				{Name: "web", DependsOn: []string{"api", "auth"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "auth", DependsOn: []string{"db"}},
+				{Name: "db"},
+			},
+			deployed: []string{"api", "auth", "db", "web"},
+		},
+		{
+			name: "failed build",
+			charts: []config.Chart{
+				{Name: "web", Images: image("web"), DependsOn: []string{"api"}},
+				{Name: "api", Images: image("api")},
+			},
+			failBuild: "api",
+			err:       true,
+		},
+		{
+			name: "failed deploy",
+			charts: []config.Chart{
+				{Name: "web", Images: image("web"), DependsOn: []string{"api"}},
+				{Name: "api", Images: image("api"), DependsOn: []string{"db"}},
+				{Name: "db"},
+			},
+			failDeploy: "api",
+			deployed:   []string{"db"},
+			err:        true,
+		},
+		{
+			// Validate reports cycles, deployAll waits until it is cancelled
+			name: "cycle",
+			charts: []config.Chart{
+				{Name: "api", DependsOn: []string{"web"}},
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "db"},
+			},
+			deployed: []string{"db"},
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		e, cluster := newFakeEngine(test.charts)
+		cluster.failBuild, cluster.failDeploy = test.failBuild, test.failDeploy
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		err := e.deployAll(ctx)
+		cancel()
+
+		if (err != nil) != test.err {
+			t.Errorf("%s: deployAll() error = %v, want error %v", test.name, err, test.err)
+		}
+		if deployed := cluster.deployed(); !reflect.DeepEqual(deployed, test.deployed) {
+			t.Errorf("%s: deployed %v, want %v", test.name, deployed, test.deployed)
+		}
+		for _, chart := range test.charts {
+			start := cluster.index("start " + chart.Name)
+			if start < 0 {
+				continue
+			}
+			for _, dependency := range chart.DependsOn {
+				if done := cluster.index("done " + dependency); done < 0 || done > start {
+					t.Errorf("%s: %s was deployed before its dependency %s: %v", test.name, chart.Name, dependency, cluster.events)
+				}
+			}
+		}
+	}
+}
+
+func TestDeployAllUnknownDependency(t *testing.T) {
+	e, cluster := newFakeEngine([]config.Chart{
+		{Name: "web", DependsOn: []string{"api"}},
+		{Name: "db"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := e.deployAll(ctx)
+	if err == nil || err.Error() != "chart web depends on unknown chart api" {
+		t.Errorf("deployAll() error = %v, want the unknown dependency", err)
+	}
+	// fails without waiting for ctx to be cancelled
+	if ctx.Err() != nil {
+		t.Error("deployAll() waited for the unknown dependency until ctx was done")
+	}
+	for _, event := range cluster.events {
+		if event == "start web" {
+			t.Error("web was deployed without its dependency")
+		}
+	}
+}
+
+func TestDeployAllInParallel(t *testing.T) {
+	e, _ := newFakeEngine([]config.Chart{{Name: "api"}, {Name: "web"}})
+	// each deploy waits for the other to start
+	started := map[string]chan struct{}{"api": make(chan struct{}), "web": make(chan struct{})}
+	other := map[string]string{"api": "web", "web": "api"}
+	e.deploy = func(ctx context.Context, chart config.Chart, values map[string]interface{}) error {
+		close(started[chart.Name])
+		select {
+		case <-started[other[chart.Name]]:
+			return nil
+		case <-time.After(time.Second):
+			return fmt.Errorf("%s was not deployed at the same time as %s", other[chart.Name], chart.Name)
+		}
+	}
+	if err := e.deployAll(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeployAllValues(t *testing.T) {
+	e, cluster := newFakeEngine([]config.Chart{{
+		Name: "app",
+		Values: map[string]interface{}{
+			"replicas":  2,
+			"app1image": "nginx",
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "nginx", "ports": []interface{}{8080}},
+			},
+		},
+		Images: []config.Image{
+			{Name: "goku/app1", ImageValueName: "app1image"},
+			{Name: "goku/app2", ImageValueName: "containers[0].image"},
+		},
+	}})
+	if err := e.deployAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the images are set over the values of the chart, keeping the rest of lists
+	want := map[string]interface{}{
+		"replicas":  2,
+		"app1image": "goku/app1:1",
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "image": "goku/app2:1", "ports": []interface{}{8080}},
+		},
+	}
+	if values := cluster.values["app"]; !reflect.DeepEqual(values, want) {
+		t.Errorf("deployed values %v, want %v", values, want)
+	}
+
+	// a rebuild sets the new image over the same values
+	cluster.version = "2"
+	chart := e.Config.Charts[0]
+	e.rebuild(context.Background(), chart, chart.Images[1])
+	want["containers"] = []interface{}{
+		map[string]interface{}{"name": "app", "image": "goku/app2:2", "ports": []interface{}{8080}},
+	}
+	if values := cluster.values["app"]; !reflect.DeepEqual(values, want) {
+		t.Errorf("values deployed after a rebuild %v, want %v", values, want)
+	}
+}
+
+func TestDeployAllValuesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"values-local.yaml": "containers:\n- name: app\n  image: nginx\n  env:\n  - name: DEBUG\n    value: \"true\"\n",
+	})
+	e, cluster := newFakeEngine([]config.Chart{{
+		Name:        "app",
+		ValuesFiles: []string{"values-local.yaml"},
+		Values:      map[string]interface{}{"replicas": 2},
+		Images:      []config.Image{{Name: "goku/app", ImageValueName: "containers[0].image"}},
+	}})
+	e.Config.BaseDir = dir
+	if err := e.deployAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"replicas": 2,
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":  "app",
+				"image": "goku/app:1",
+				"env":   []interface{}{map[string]interface{}{"name": "DEBUG", "value": "true"}},
+			},
+		},
+	}
+	if values := cluster.values["app"]; !reflect.DeepEqual(values, want) {
+		t.Errorf("deployed values %v, want %v", values, want)
+	}
+}
+
+func TestRebuildSkipsDeployedImage(t *testing.T) {
+	chart := config.Chart{Name: "app", Images: []config.Image{{Name: "goku/app", ImageValueName: "image", Path: "app"}}}
+	e, cluster := newFakeEngine([]config.Chart{chart})
+	ctx := context.Background()
+	if err := e.deployAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	starts := func() int {
+		cluster.mu.Lock()
+		defer cluster.mu.Unlock()
+		n := 0
+		for _, event := range cluster.events {
+			if event == "start app" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// the build gives the image already deployed
+	e.rebuild(ctx, chart, chart.Images[0])
+	if n := starts(); n != 1 {
+		t.Errorf("app was deployed %d times after rebuilding the same image, want 1", n)
+	}
+
+	// a failed deploy of a new image is tried again by the next rebuild
+	cluster.version = "2"
+	cluster.failDeploy = "app"
+	e.rebuild(ctx, chart, chart.Images[0])
+	cluster.failDeploy = ""
+	e.rebuild(ctx, chart, chart.Images[0])
+	if n := starts(); n != 3 {
+		t.Errorf("app was deployed %d times after a failed deploy and a rebuild, want 3", n)
+	}
+}
+
+func TestDeployAllSkipsReleasedCharts(t *testing.T) {
+	e, cluster := newFakeEngine([]config.Chart{
+		{Name: "app", Images: []config.Image{{Name: "goku/app", ImageValueName: "image", Path: "app"}}},
+		{Name: "db", DependsOn: []string{"app"}},
+	})
+	ctx := context.Background()
+	if err := e.deployAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// starting again with the same images leaves the releases alone
+	if err := e.deployAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"start app", "done app", "start db", "done db"}; !reflect.DeepEqual(cluster.events, want) {
+		t.Errorf("deploy events = %v, want %v", cluster.events, want)
+	}
+
+	// a new image is deployed
+	cluster.version = "2"
+	if err := e.deployAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"start app", "done app", "start db", "done db", "start app", "done app"}; !reflect.DeepEqual(cluster.events, want) {
+		t.Errorf("deploy events = %v, want %v", cluster.events, want)
+	}
+
+	// errors checking the releases stop deploying
+	e.released = func(ctx context.Context, chart config.Chart, values map[string]interface{}) (bool, error) {
+		return false, fmt.Errorf("can't contact Tiller")
+	}
+	if err := e.deployAll(ctx); err == nil {
+		t.Error("deployAll() succeeded without contacting Tiller")
+	}
+}
+
+func TestSameValues(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"image: goku/app:1\n", "image: goku/app:1\n", true},
+		{"b: 1\na: {c: [x]}\n", "a:\n  c:\n  - x\nb: 1\n", true},
+		{"", "{}\n", true},
+		{"image: goku/app:1\n", "image: goku/app:2\n", false},
+		{"image: goku/app:1\n", "image: goku/app:1\nreplicas: 2\n", false},
+	}
+	for _, test := range tests {
+		got, err := sameValues(test.a, test.b)
+		if err != nil {
+			t.Errorf("sameValues(%q, %q) error: %v", test.a, test.b, err)
+		}
+		if got != test.want {
+			t.Errorf("sameValues(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+	if _, err := sameValues("a: [", "a: 1"); err == nil {
+		t.Error("sameValues() of invalid YAML succeeded")
+	}
+}
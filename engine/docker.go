@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/sockets"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// dockerClient connects to docker from the environment like
+// client.NewEnvClient. The vendored docker client predates some build
+// options, such as the target stage, so buildQuery is added to the query of
+// every build request.
+type dockerClient struct {
+	*client.Client
+	transport *http.Transport
+}
+
+func newDockerClient(buildQuery url.Values) (*dockerClient, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = client.DefaultDockerHost
+	}
+	version := os.Getenv("DOCKER_API_VERSION")
+	if version == "" {
+		version = client.DefaultVersion
+	}
+	proto, addr, _, err := client.ParseHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := new(http.Transport)
+	if err := sockets.ConfigureTransport(transport, proto, addr); err != nil {
+		return nil, err
+	}
+	if dockerCertPath := os.Getenv("DOCKER_CERT_PATH"); dockerCertPath != "" {
+		tlsc, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             filepath.Join(dockerCertPath, "ca.pem"),
+			CertFile:           filepath.Join(dockerCertPath, "cert.pem"),
+			KeyFile:            filepath.Join(dockerCertPath, "key.pem"),
+			InsecureSkipVerify: os.Getenv("DOCKER_TLS_VERIFY") == "",
+		})
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsc
+	}
+
+	httpClient := &http.Client{Transport: transport}
+	cli, err := client.NewClient(host, version, httpClient, nil)
+	if err != nil {
+		return nil, err
+	}
+	// NewClient only accepts an *http.Transport, the query is added afterwards
+	if len(buildQuery) > 0 {
+		httpClient.Transport = &buildQueryTransport{base: transport, query: buildQuery}
+	}
+	return &dockerClient{Client: cli, transport: transport}, nil
+}
+
+// Close the idle connections to docker
+func (c *dockerClient) Close() error {
+	c.transport.CloseIdleConnections()
+	return nil
+}
+
+// buildQueryTransport adds query parameters to the build requests
+type buildQueryTransport struct {
+	base  http.RoundTripper
+	query url.Values
+}
+
+func (t *buildQueryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/build") {
+		return t.base.RoundTrip(req)
+	}
+	u := *req.URL
+	query := u.Query()
+	for name, values := range t.query {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+
+	r := new(http.Request)
+	*r = *req
+	r.URL = &u
+	return t.base.RoundTrip(r)
+}
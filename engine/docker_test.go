@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// recordingTransport records the URL of the last request instead of sending it
+type recordingTransport struct {
+	url *url.URL
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.url = req.URL
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestBuildQueryTransport(t *testing.T) {
+	query := url.Values{"target": {"dev"}}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://docker/v1.30/build?t=goku%2Fapp%3A1", "t=goku%2Fapp%3A1&target=dev"},
+		{"http://docker/v1.30/build?target=prod", "target=dev"},
+		{"http://docker/v1.30/images/goku/app/json", ""},
+		{"http://docker/v1.30/containers/json?all=1", "all=1"},
+	}
+	for _, test := range tests {
+		base := &recordingTransport{}
+		transport := &buildQueryTransport{base: base, query: query}
+		req, err := http.NewRequest("POST", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if base.url.RawQuery != test.want {
+			t.Errorf("query of %s = %q, want %q", test.url, base.url.RawQuery, test.want)
+		}
+		if req.URL.String() != test.url {
+			t.Errorf("the request to %s was modified to %s", test.url, req.URL)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Package engine builds the Docker images of a goku.yaml config inside the
+// local Kubernetes node and deploys its charts with Helm, rebuilding and
+// redeploying whenever the watched files change.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/timatooth/goku/config"
+)
+
+// DefaultTillerHost is where goku port-forwards Tiller to
+const DefaultTillerHost = "127.0.0.1:44134"
+
+// Engine builds and deploys the charts of a goku config
+type Engine struct {
+	Config *config.GokuConfig
+	// Address of the Tiller gRPC server
+	TillerHost string
+
+	// Print the raw docker build output too
+	Verbose bool
+	// Build every image instead of reusing images built from the same files
+	NoBuildCache bool
+	// How files are watched: WatchAuto, WatchNotify or WatchPoll
+	WatchMode string
+	// How long Helm waits for the resources of a chart other charts depend on to be ready
+	ReadyTimeout time.Duration
+
+	mu sync.Mutex
+	// images last built for each chart, by chart name and image value
+	images map[string]map[string]BuiltImage
+	// names of the charts depending on each chart
+	dependents map[string][]string
+	// images built from each build context, loaded by Watch
+	cache *buildCache
+	// content hashes of the files of each build context
+	hashes *fileHashes
+	// image last deployed for each chart and image value
+	deployed map[string]string
+	// queues builds and cancels superseded ones
+	builds *scheduler
+	// Build, Deploy and Released, replaced in tests
+	build    func(ctx context.Context, image config.Image) (BuiltImage, error)
+	deploy   func(ctx context.Context, chart config.Chart, values map[string]interface{}) error
+	released func(ctx context.Context, chart config.Chart, values map[string]interface{}) (bool, error)
+}
+
+// New creates an Engine for a goku config
+func New(gokuConfig *config.GokuConfig) *Engine {
+	e := &Engine{
+		Config:       gokuConfig,
+		TillerHost:   DefaultTillerHost,
+		ReadyTimeout: 5 * time.Minute,
+		WatchMode:    WatchAuto,
+		images:       make(map[string]map[string]BuiltImage),
+		dependents:   gokuConfig.Dependents(),
+		deployed:     make(map[string]string),
+		hashes:       newFileHashes(),
+		builds:       newScheduler(gokuConfig.Build.Concurrency),
+	}
+	e.build, e.deploy, e.released = e.Build, e.Deploy, e.Released
+	return e
+}
+
+// Watch builds every image and deploys every chart, then watches each
+// image's Path and rebuilds and redeploys its chart on changes. It blocks
+// until ctx is cancelled or watching fails.
+func (e *Engine) Watch(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if !e.NoBuildCache {
+		e.cache = loadBuildCache(e.path(CacheDir))
+	}
+	if err := e.deployAll(ctx); err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+	var wg, rebuilds sync.WaitGroup
+	for _, chart := range e.Config.Charts {
+		for _, image := range chart.Images {
+			wg.Add(1)
+			// Go thread to watch each image's file structure
+			// build and update chart on any file change.
+			go func(chart config.Chart, image config.Image) {
+				defer wg.Done()
+				// ignored files, such as those the build context excludes, don't trigger rebuilds
+				rules, err := e.watchRules(image)
+				if err == nil {
+					err = e.watchFiles(ctx, e.path(image.Path), rules.ignored, e.debounce(image), func(changes ChangeSet) {
+						log.Printf("%s in %s", changes, image.Name)
+						if e.Verbose {
+							for _, path := range changes.Paths() {
+								log.Printf("  %s", path)
+							}
+						}
+						// keep watching so a newer change can supersede the build
+						rebuilds.Add(1)
+						go func() {
+							defer rebuilds.Done()
+							e.rebuild(ctx, chart, image)
+						}()
+					})
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+				}
+			}(chart, image)
+		}
+	}
+	//block until all threads end
+	wg.Wait()
+	rebuilds.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// deployAll builds the images of every chart and deploys it. Charts are
+// deployed in parallel, except that a chart waits until the charts it
+// depends on are deployed and ready.
+func (e *Engine) deployAll(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ready := make(map[string]chan struct{}, len(e.Config.Charts))
+	for _, chart := range e.Config.Charts {
+		ready[chart.Name] = make(chan struct{})
+	}
+
+	errs := make(chan error, len(e.Config.Charts))
+	var wg sync.WaitGroup
+	for _, chart := range e.Config.Charts {
+		wg.Add(1)
+		go func(chart config.Chart) {
+			defer wg.Done()
+			for _, dependency := range chart.DependsOn {
+				dependencyReady, ok := ready[dependency]
+				if !ok {
+					errs <- fmt.Errorf("chart %s depends on unknown chart %s", chart.Name, dependency)
+					cancel()
+					return
+				}
+				log.Printf("Waiting for %s to be ready before deploying %s", dependency, chart.Name)
+				select {
+				case <-dependencyReady:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			//TODO this is an initial build/bootstrap on startup... to be removed?
+			for _, image := range chart.Images {
+				built, err := e.build(ctx, image)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				e.setImage(chart.Name, image, built)
+				e.setDeployed(chart.Name, image, built)
+			}
+
+			values, err := e.chartValues(chart)
+			if err == nil {
+				err = e.deployChanged(ctx, chart, values)
+			}
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			close(ready[chart.Name])
+		}(chart)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// deployChanged deploys a chart unless its release already runs it with
+// values, such as when every image was reused from the build cache
+func (e *Engine) deployChanged(ctx context.Context, chart config.Chart, values map[string]interface{}) error {
+	released, err := e.released(ctx, chart, values)
+	if err != nil {
+		return err
+	}
+	if released {
+		log.Printf("%s already runs these images and values, skipping upgrade", ReleaseName(chart))
+		return nil
+	}
+	return e.deploy(ctx, chart, values)
+}
+
+// rebuild an image after its files changed and redeploy its chart. Failures
+// are logged so watching carries on until the next change. A newer change to
+// the image cancels the rebuild until it is deployed.
+func (e *Engine) rebuild(ctx context.Context, chart config.Chart, image config.Image) {
+	ctx, done := e.builds.start(ctx, chart.Name+"/"+image.ImageValueName, image.Name)
+	defer done()
+	if ctx.Err() != nil {
+		return
+	}
+
+	built, err := e.build(ctx, image)
+	if ctx.Err() != nil {
+		log.Printf("Cancelled build of %s", image.Name)
+		return
+	}
+	if err != nil {
+		log.Printf("Build of %s failed: %v", image.Name, err)
+		return
+	}
+	if !e.setDeployed(chart.Name, image, built) {
+		log.Printf("%s is already deployed in %s, skipping deploy", built.Reference(), chart.Name)
+		return
+	}
+
+	e.setImage(chart.Name, image, built)
+	values, err := e.chartValues(chart)
+	if err != nil {
+		log.Printf("Could not set the images in the values of %s: %v", chart.Name, err)
+		e.setDeployed(chart.Name, image, BuiltImage{})
+		return
+	}
+	if err := e.deploy(ctx, chart, values); err != nil {
+		log.Printf("Deploy of %s failed: %v", chart.Name, err)
+		// deploy it again even if the next build gives the same image
+		e.setDeployed(chart.Name, image, BuiltImage{})
+		return
+	}
+	if chart.RedeployDependents {
+		e.redeployDependents(ctx, chart.Name)
+	}
+}
+
+// redeployDependents redeploys the charts depending on a chart with the
+// images they were last deployed with, and in turn their dependents if they
+// set redeployDependents too.
+func (e *Engine) redeployDependents(ctx context.Context, chartName string) {
+	for _, dependentName := range e.dependents[chartName] {
+		if ctx.Err() != nil {
+			return
+		}
+		dependent, ok := e.chart(dependentName)
+		if !ok {
+			continue
+		}
+		log.Printf("Redeploying %s as it depends on %s", dependent.Name, chartName)
+		values, err := e.chartValues(dependent)
+		if err == nil {
+			err = e.deploy(ctx, dependent, values)
+		}
+		if err != nil {
+			log.Printf("Deploy of %s failed: %v", dependent.Name, err)
+			continue
+		}
+		if dependent.RedeployDependents {
+			e.redeployDependents(ctx, dependent.Name)
+		}
+	}
+}
+
+// debounce returns how long to wait for further changes to an image before
+// rebuilding it
+func (e *Engine) debounce(image config.Image) time.Duration {
+	debounce := image.Debounce
+	if debounce == "" {
+		debounce = e.Config.Watch.Debounce
+	}
+	// goku.yaml durations are validated
+	if d, err := time.ParseDuration(debounce); err == nil {
+		return d
+	}
+	return defaultDebounce
+}
+
+func (e *Engine) chart(name string) (config.Chart, bool) {
+	for _, chart := range e.Config.Charts {
+		if chart.Name == name {
+			return chart, true
+		}
+	}
+	return config.Chart{}, false
+}
+
+// setDeployed records the image deployed for an image value of a chart and
+// reports if it changed
+func (e *Engine) setDeployed(chartName string, image config.Image, built BuiltImage) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := chartName + "/" + image.ImageValueName
+	if e.deployed[key] == built.ID {
+		return false
+	}
+	e.deployed[key] = built.ID
+	return true
+}
+
+// setImage records the image last built for an image value of a chart
+func (e *Engine) setImage(chartName string, image config.Image, built BuiltImage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.images[chartName] == nil {
+		e.images[chartName] = make(map[string]BuiltImage)
+	}
+	e.images[chartName][image.ImageValueName] = built
+}
+
+// chartValues returns the values to deploy a chart with: its ChartValues
+// with the images last built for it set over them. Images are set at their
+// value path rather than merged, so lists such as containers keep their
+// other entries and fields.
+func (e *Engine) chartValues(chart config.Chart) (map[string]interface{}, error) {
+	values, err := e.Config.ChartValues(chart)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, image := range chart.Images {
+		built, ok := e.images[chart.Name][image.ImageValueName]
+		if !ok {
+			continue
+		}
+		if values, err = imageValues(values, image, built); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// imageValues returns a copy of values with a built image set at its
+// ImageValueName in its ImageValueFormat
+func imageValues(values map[string]interface{}, image config.Image, built BuiltImage) (map[string]interface{}, error) {
+	switch image.ImageValueFormat {
+	case config.ImageValueSplit:
+		values, err := config.SetValue(values, image.ImageValueName+".repository", built.Name)
+		if err != nil {
+			return nil, err
+		}
+		return config.SetValue(values, image.ImageValueName+".tag", built.Tag)
+	case config.ImageValueID:
+		return config.SetValue(values, image.ImageValueName, built.ID)
+	default:
+		return config.SetValue(values, image.ImageValueName, built.Reference())
+	}
+}
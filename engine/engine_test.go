@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/timatooth/goku/config"
+)
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		baseDir string
+		relPath string
+		want    string
+	}{
+		{"", "app1", "app1"},
+		{".", "app1", "app1"},
+		{"/src/project", "app1", "/src/project/app1"},
+		{"/src/project", "./charts/app/", "/src/project/charts/app"},
+		{"project", "../shared", "shared"},
+	}
+	for _, test := range tests {
+		e := New(&config.GokuConfig{BaseDir: test.baseDir})
+		if got := e.path(test.relPath); got != test.want {
+			t.Errorf("path(%q) with BaseDir %q = %q, want %q", test.relPath, test.baseDir, got, test.want)
+		}
+	}
+}
+
+func TestChartValues(t *testing.T) {
+	app1 := config.Image{Name: "goku/app1", ImageValueName: "app1image"}
+	app2 := config.Image{Name: "goku/app2", ImageValueName: "app2.image", ImageValueFormat: config.ImageValueSplit}
+	sidecar := config.Image{Name: "goku/sidecar", ImageValueName: "containers[1].image"}
+	chart := config.Chart{
+		Name: "app",
+		Values: map[string]interface{}{
+			"replicas":  1,
+			"app1image": "nginx",
+			"app2":      map[string]interface{}{"image": map[string]interface{}{"pullPolicy": "Never"}},
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "nginx"},
+				map[string]interface{}{"name": "sidecar", "image": "busybox", "args": []interface{}{"sleep"}},
+			},
+		},
+		Images: []config.Image{app1, app2, sidecar},
+	}
+	e := New(&config.GokuConfig{Charts: []config.Chart{chart}})
+
+	// nothing built yet
+	values, err := e.chartValues(chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, chart.Values) {
+		t.Errorf("chartValues() = %v, want the values of the chart %v", values, chart.Values)
+	}
+
+	e.setImage("app", app1, BuiltImage{Name: "goku/app1", Tag: "1"})
+	e.setImage("app", app2, BuiltImage{Name: "goku/app2", Tag: "1"})
+	e.setImage("app", sidecar, BuiltImage{Name: "goku/sidecar", Tag: "1"})
+	e.setImage("app", app1, BuiltImage{Name: "goku/app1", Tag: "2"})
+	values, err = e.chartValues(chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"replicas":  1,
+		"app1image": "goku/app1:2",
+		"app2":      map[string]interface{}{"image": map[string]interface{}{"pullPolicy": "Never", "repository": "goku/app2", "tag": "1"}},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "image": "nginx"},
+			map[string]interface{}{"name": "sidecar", "image": "goku/sidecar:1", "args": []interface{}{"sleep"}},
+		},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("chartValues() = %v, want %v", values, want)
+	}
+
+	// the values of the chart are not modified
+	containers := chart.Values["containers"].([]interface{})
+	if image := containers[1].(map[string]interface{})["image"]; image != "busybox" {
+		t.Errorf("chartValues() changed the values of the chart to %v", chart.Values)
+	}
+
+	e.setImage("app", config.Image{ImageValueName: "bad..path"}, BuiltImage{})
+	chart.Images = append(chart.Images, config.Image{ImageValueName: "bad..path"})
+	if _, err := e.chartValues(chart); err == nil {
+		t.Error("chartValues() accepted an invalid value path")
+	}
+}
+
+func TestImageValues(t *testing.T) {
+	built := BuiltImage{Name: "goku/app", Tag: "1", ID: "sha256:0123"}
+	values := map[string]interface{}{
+		"replicas":   2,
+		"image":      map[string]interface{}{"pullPolicy": "Never"},
+		"containers": []interface{}{map[string]interface{}{"name": "app"}},
+	}
+	tests := []struct {
+		name   string
+		format string
+		want   map[string]interface{}
+	}{
+		{"appimage", "", map[string]interface{}{"appimage": "goku/app:1"}},
+		{"image.ref", config.ImageValueFull, map[string]interface{}{
+			"image": map[string]interface{}{"pullPolicy": "Never", "ref": "goku/app:1"},
+		}},
+		{"image", config.ImageValueSplit, map[string]interface{}{
+			"image": map[string]interface{}{"pullPolicy": "Never", "repository": "goku/app", "tag": "1"},
+		}},
+		{`annotations.goku\.io/image`, config.ImageValueID, map[string]interface{}{
+			"annotations": map[string]interface{}{"goku.io/image": "sha256:0123"},
+		}},
+		{"containers[0].image", "", map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "app", "image": "goku/app:1"}},
+		}},
+	}
+	for _, test := range tests {
+		image := config.Image{Name: "goku/app", ImageValueName: test.name, ImageValueFormat: test.format}
+		got, err := imageValues(values, image, built)
+		if err != nil {
+			t.Errorf("imageValues(%s) failed: %v", test.name, err)
+			continue
+		}
+		want := config.MergeValues(values, test.want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("imageValues(%s, %q) = %v, want %v", test.name, test.format, got, want)
+		}
+	}
+	if _, ok := values["appimage"]; ok {
+		t.Error("imageValues() modified the values it was given")
+	}
+}
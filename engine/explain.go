@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/timatooth/goku/config"
+	"github.com/timatooth/goku/ignore"
+)
+
+// watchRules decide which changes below the path of an image are ignored
+type watchRules struct {
+	// absolute paths of the image's Path and build context
+	watchPath   string
+	contextPath string
+	// files the build context excludes
+	contextExcludes *ignore.Matcher
+	// ignore patterns of the image
+	globs *ignore.Globs
+	// .gitignore and .dockerignore files below the watch path, if watch reads them
+	gitignores    *ignore.Matcher
+	dockerignores *ignore.Matcher
+}
+
+func (e *Engine) watchRules(image config.Image) (*watchRules, error) {
+	contextPath, dockerFile := imageContext(image)
+	excludes, err := contextExcludes(e.path(contextPath), dockerFile)
+	if err != nil {
+		return nil, err
+	}
+	globs, err := ignore.NewGlobs(image.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	rules := &watchRules{contextExcludes: excludes, globs: globs}
+	// the watchers report absolute paths
+	if rules.watchPath, err = filepath.Abs(e.path(image.Path)); err != nil {
+		return nil, err
+	}
+	if rules.contextPath, err = filepath.Abs(e.path(contextPath)); err != nil {
+		return nil, err
+	}
+
+	if e.Config.Watch.Gitignore {
+		if rules.gitignores, err = ignore.ReadGitignores(rules.watchPath); err != nil {
+			return nil, err
+		}
+	}
+	if e.Config.Watch.Dockerignore {
+		if rules.dockerignores, err = ignore.ReadDockerignores(rules.watchPath); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// ignored reports if changes to a path are ignored. Directories are only
+// ignored when nothing below them can be re-included.
+func (r *watchRules) ignored(path string, isDir bool) bool {
+	ignored, _ := r.explain(path, isDir)
+	return ignored
+}
+
+// explain reports if changes to a path are ignored and the rule deciding it.
+// The rule of a path which is not ignored is the pattern re-including it, if any.
+func (r *watchRules) explain(path string, isDir bool) (bool, string) {
+	var included string
+	if rel, ok := relPath(r.watchPath, path); ok {
+		for _, segment := range strings.Split(filepath.ToSlash(rel), "/") {
+			if strings.HasPrefix(segment, ".") {
+				// the watchers leave out hidden files and directories
+				return true, fmt.Sprintf("the hidden name %q", segment)
+			}
+		}
+		if pattern := r.globs.Match(rel); pattern != "" {
+			return true, fmt.Sprintf("ignore pattern %q of the image", pattern)
+		}
+		for _, m := range []*ignore.Matcher{r.gitignores, r.dockerignores} {
+			if m == nil {
+				continue
+			}
+			excluded, rule := m.Match(rel)
+			if excluded && (!isDir || m.SkipDir(rel)) {
+				return true, describeRule(r.watchPath, rule)
+			}
+			if !excluded && rule.Pattern != "" {
+				included = describeRule(r.watchPath, rule)
+			}
+		}
+	}
+	if rel, ok := relPath(r.contextPath, path); ok {
+		excluded, rule := r.contextExcludes.Match(rel)
+		if excluded && (!isDir || r.contextExcludes.SkipDir(rel)) {
+			return true, describeRule(r.contextPath, rule)
+		}
+		if !excluded && rule.Pattern != "" {
+			included = describeRule(r.contextPath, rule)
+		}
+	}
+	return false, included
+}
+
+func describeRule(dir string, rule ignore.Rule) string {
+	if rule.File == "" {
+		return fmt.Sprintf("%q, as docker build always sends it", rule.Pattern)
+	}
+	return fmt.Sprintf("%q in %s", rule.Pattern, filepath.Join(dir, filepath.FromSlash(rule.File)))
+}
+
+// relPath returns a path relative to dir, if it is below dir
+func relPath(dir string, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// Explain writes, for each image whose Path a file is below, whether changes
+// to the file trigger rebuilds and the rule deciding it
+func (e *Engine) Explain(w io.Writer, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	isDir := err == nil && info.IsDir()
+
+	found := false
+	for _, chart := range e.Config.Charts {
+		for _, image := range chart.Images {
+			rules, err := e.watchRules(image)
+			if err != nil {
+				return err
+			}
+			if _, ok := relPath(rules.watchPath, path); !ok {
+				continue
+			}
+			found = true
+			ignored, rule := rules.explain(path, isDir)
+			switch {
+			case ignored:
+				fmt.Fprintf(w, "%s of %s: ignored by %s\n", image.Name, chart.Name, rule)
+			case rule != "":
+				fmt.Fprintf(w, "%s of %s: rebuilt on changes, re-included by %s\n", image.Name, chart.Name, rule)
+			default:
+				fmt.Fprintf(w, "%s of %s: rebuilt on changes, no rule ignores it\n", image.Name, chart.Name)
+			}
+		}
+	}
+	if !found {
+		fmt.Fprintf(w, "%s is not below the path of any image\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timatooth/goku/config"
+)
+
+func TestWatchRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"app/.dockerignore":     "node_modules\n*.log\ndocs\n!docs/index.md\nDockerfile\n",
+		"app/Dockerfile":        "FROM alpine\n",
+		"app/.gitignore":        "build/\n",
+		"app/web/.gitignore":    "*.tmp\n!keep.tmp\n",
+		"app/web/.dockerignore": "dist\n",
+	})
+	image := config.Image{Name: "goku/app", Path: "app", Ignore: []string{"*.pyc", "reports/**"}}
+
+	tests := []struct {
+		name         string
+		gitignore    bool
+		dockerignore bool
+		path         string
+		isDir        bool
+		want         bool
+		wantRule     string
+	}{
+		{name: "source", path: "main.go"},
+		{name: "context exclude", path: "debug.log", want: true, wantRule: `"*.log" in ` + filepath.Join(dir, "app", ".dockerignore")},
+		{name: "context exclude in a directory", path: "logs/debug.log"},
+		{name: "excluded directory", path: "node_modules", isDir: true, want: true, wantRule: `"node_modules" in ` + filepath.Join(dir, "app", ".dockerignore")},
+		{name: "below an excluded directory", path: "node_modules/left-pad/index.js", want: true, wantRule: `"node_modules" in ` + filepath.Join(dir, "app", ".dockerignore")},
+		{name: "directory with a re-included file", path: "docs", isDir: true},
+		{name: "re-included", path: "docs/index.md", wantRule: `"!docs/index.md" in ` + filepath.Join(dir, "app", ".dockerignore")},
+		{name: "always sent", path: "Dockerfile", wantRule: `"!Dockerfile", as docker build always sends it`},
+		{name: "hidden", path: ".env", want: true, wantRule: `the hidden name ".env"`},
+		{name: "hidden directory", path: ".git/HEAD", want: true, wantRule: `the hidden name ".git"`},
+		{name: "image glob", path: "lib/cache.pyc", want: true, wantRule: `ignore pattern "*.pyc" of the image`},
+		{name: "image glob directory", path: "reports/today/index.html", want: true, wantRule: `ignore pattern "reports/**" of the image`},
+		{name: "gitignore off", path: "build/app"},
+		{name: "gitignore", gitignore: true, path: "build/app", want: true, wantRule: `"build/" in ` + filepath.Join(dir, "app", ".gitignore")},
+		{name: "nested gitignore", gitignore: true, path: "web/a.tmp", want: true, wantRule: `"*.tmp" in ` + filepath.Join(dir, "app", "web", ".gitignore")},
+		{name: "nested gitignore re-included", gitignore: true, path: "web/keep.tmp", wantRule: `"!keep.tmp" in ` + filepath.Join(dir, "app", "web", ".gitignore")},
+		{name: "nested gitignore outside of it", gitignore: true, path: "a.tmp"},
+		{name: "dockerignore off", path: "web/dist/app.js"},
+		{name: "dockerignore", dockerignore: true, path: "web/dist/app.js", want: true, wantRule: `"dist" in ` + filepath.Join(dir, "app", "web", ".dockerignore")},
+	}
+	for _, test := range tests {
+		e := New(&config.GokuConfig{BaseDir: dir, Watch: config.WatchConfig{Gitignore: test.gitignore, Dockerignore: test.dockerignore}})
+		rules, err := e.watchRules(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "app", filepath.FromSlash(test.path))
+		got, rule := rules.explain(path, test.isDir)
+		if got != test.want || rule != test.wantRule {
+			t.Errorf("%s: explain(%s) = %v, %q, want %v, %q", test.name, test.path, got, rule, test.want, test.wantRule)
+		}
+		if ignored := rules.ignored(path, test.isDir); ignored != test.want {
+			t.Errorf("%s: ignored(%s) = %v, want %v", test.name, test.path, ignored, test.want)
+		}
+	}
+}
+
+func TestWatchRulesContextPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".dockerignore":       "**/*.md\n",
+		"services/app/app.go": "package app\n",
+	})
+	// the build context holds the watched path
+	e := New(&config.GokuConfig{BaseDir: dir})
+	rules, err := e.watchRules(config.Image{Name: "goku/app", Path: "services/app", ContextPath: "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ignored, rule := rules.explain(filepath.Join(dir, "services/app/Readme.md"), false); !ignored || rule != `"**/*.md" in `+filepath.Join(dir, ".dockerignore") {
+		t.Errorf("explain() of a file the context excludes = %v, %q", ignored, rule)
+	}
+	// paths outside of the context are never excluded by it
+	if ignored, _ := rules.explain(filepath.Join(filepath.Dir(dir), "Readme.md"), false); ignored {
+		t.Error("explain() of a file outside of the context ignored it")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"app1/.dockerignore": "*.log\n!keep.log\n",
+		"app2/main.go":       "package main\n",
+	})
+	e := New(&config.GokuConfig{BaseDir: dir, Charts: []config.Chart{
+		{Name: "chart1", Images: []config.Image{{Name: "goku/app1", Path: "app1"}}},
+		{Name: "chart2", Images: []config.Image{
+			{Name: "goku/app2", Path: "app2"},
+			{Name: "goku/all", Path: "."},
+		}},
+	}})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{
+			path: "app1/debug.log",
+			want: "goku/app1 of chart1: ignored by \"*.log\" in " + filepath.Join(dir, "app1", ".dockerignore") + "\n" +
+				"goku/all of chart2: rebuilt on changes, no rule ignores it\n",
+		},
+		{
+			path: "app1/keep.log",
+			want: "goku/app1 of chart1: rebuilt on changes, re-included by \"!keep.log\" in " + filepath.Join(dir, "app1", ".dockerignore") + "\n" +
+				"goku/all of chart2: rebuilt on changes, no rule ignores it\n",
+		},
+		{
+			path: "app2/main.go",
+			want: "goku/app2 of chart2: rebuilt on changes, no rule ignores it\n" +
+				"goku/all of chart2: rebuilt on changes, no rule ignores it\n",
+		},
+		{
+			path: "../elsewhere.go",
+			want: filepath.Join(filepath.Dir(dir), "elsewhere.go") + " is not below the path of any image\n",
+		},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := e.Explain(&out, filepath.Join(dir, filepath.FromSlash(test.path))); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.want {
+			t.Errorf("Explain(%s) printed %q, want %q", test.path, out.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fatih/color"
+	"github.com/timatooth/goku/config"
+)
+
+// Base image of the go builder, the binary must not need anything from it
+const defaultGoBaseImage = "scratch"
+
+// goBuilder cross-compiles a Go main package on the host, using its build
+// cache, and builds an image of just the binary on top of a base image
+type goBuilder struct{}
+
+func (goBuilder) Build(ctx context.Context, req BuildRequest) (string, error) {
+	tmp, err := ioutil.TempDir("", "goku-go")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	binary := filepath.Join(tmp, "app")
+	if err := runBuildCommand(goBuildCommand(ctx, req, binary), req.Image.Name); err != nil {
+		return "", err
+	}
+	dockerfile := goDockerfile(req.Image.Go)
+
+	cli, err := newDockerClient(nil)
+	if err != nil {
+		return "", fmt.Errorf("could not connect to docker: %v", err)
+	}
+	defer cli.Close()
+
+	buildContext, pw := io.Pipe()
+	defer buildContext.Close()
+	go func() {
+		pw.CloseWithError(writeGoContext(pw, dockerfile, binary))
+	}()
+
+	imageBuildResponse, err := cli.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:       req.Tags(),
+		Dockerfile: "Dockerfile",
+		Labels:     req.Image.Labels,
+		NoCache:    req.Image.NoCache,
+		Remove:     true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer imageBuildResponse.Body.Close()
+	return readBuildOutput(imageBuildResponse.Body, color.Output, "["+req.Image.Name+"] ", req.Verbose)
+}
+
+// goBuildCommand compiles the main package of req into binary for linux
+func goBuildCommand(ctx context.Context, req BuildRequest, binary string) *exec.Cmd {
+	goBuild := req.Image.Go
+	mainPackage := goBuild.Main
+	if mainPackage == "" {
+		mainPackage = "."
+	}
+	arch := goBuild.Arch
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	cgo := "0"
+	if goBuild.Cgo {
+		cgo = "1"
+	}
+	args := append([]string{"build", "-o", binary}, goBuild.Flags...)
+	cmd := exec.CommandContext(ctx, "go", append(args, mainPackage)...)
+	cmd.Dir = req.ContextPath
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED="+cgo)
+	return cmd
+}
+
+// goDockerfile copies the binary onto the base image
+func goDockerfile(goBuild config.GoBuild) string {
+	baseImage := goBuild.BaseImage
+	if baseImage == "" {
+		baseImage = defaultGoBaseImage
+	}
+	return fmt.Sprintf("FROM %s\nCOPY app /app\nENTRYPOINT [\"/app\"]\n", baseImage)
+}
+
+// writeGoContext archives the Dockerfile and binary of the go builder. The
+// headers are normalized so the same binary reuses the docker layer cache.
+func writeGoContext(w io.Writer, dockerfile string, binary string) error {
+	tw := tar.NewWriter(w)
+	h := &tar.Header{Typeflag: tar.TypeReg, Name: "Dockerfile", Mode: 0644, Size: int64(len(dockerfile)), ModTime: time.Unix(0, 0)}
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(tw, dockerfile); err != nil {
+		return err
+	}
+
+	f, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	h = &tar.Header{Typeflag: tar.TypeReg, Name: "app", Mode: 0755, Size: info.Size(), ModTime: time.Unix(0, 0)}
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return err
+	}
+	return tw.Close()
+}
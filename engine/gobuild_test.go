@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/timatooth/goku/config"
+)
+
+func TestGoBuildCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		goBuild  config.GoBuild
+		wantArgs string
+		wantEnv  []string
+	}{
+		{
+			name:     "defaults",
+			wantArgs: "go build -o /tmp/app .",
+			wantEnv:  []string{"GOOS=linux", "GOARCH=" + runtime.GOARCH, "CGO_ENABLED=0"},
+		},
+		{
+			name: "every option",
+			goBuild: config.GoBuild{
+				Main:  "./cmd/app",
+				Flags: []string{"-tags", "netgo", "-ldflags=-s -w"},
+				Arch:  "arm64",
+				Cgo:   true,
+			},
+			wantArgs: "go build -o /tmp/app -tags netgo -ldflags=-s -w ./cmd/app",
+			wantEnv:  []string{"GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=1"},
+		},
+	}
+	for _, test := range tests {
+		req := BuildRequest{Image: config.Image{Name: "goku/app1", Go: test.goBuild}, ContextPath: "services/app1"}
+		cmd := goBuildCommand(context.Background(), req, "/tmp/app")
+		if got := strings.Join(cmd.Args, " "); got != test.wantArgs {
+			t.Errorf("%s: goBuildCommand() runs %q, want %q", test.name, got, test.wantArgs)
+		}
+		if cmd.Dir != "services/app1" {
+			t.Errorf("%s: goBuildCommand() runs in %q, want the build context", test.name, cmd.Dir)
+		}
+		// the last values of the environment win
+		if got := cmd.Env[len(cmd.Env)-len(test.wantEnv):]; !reflect.DeepEqual(got, test.wantEnv) {
+			t.Errorf("%s: goBuildCommand() sets %q, want %q", test.name, got, test.wantEnv)
+		}
+	}
+}
+
+func TestGoDockerfile(t *testing.T) {
+	tests := []struct {
+		baseImage string
+		want      string
+	}{
+		{"", "FROM scratch\nCOPY app /app\nENTRYPOINT [\"/app\"]\n"},
+		{"gcr.io/distroless/static", "FROM gcr.io/distroless/static\nCOPY app /app\nENTRYPOINT [\"/app\"]\n"},
+	}
+	for _, test := range tests {
+		if got := goDockerfile(config.GoBuild{BaseImage: test.baseImage}); got != test.want {
+			t.Errorf("goDockerfile() with baseImage %q = %q, want %q", test.baseImage, got, test.want)
+		}
+	}
+}
+
+func TestWriteGoContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	binary := filepath.Join(dir, "app")
+	writeFiles(t, dir, map[string]string{"app": "\x7fELF binary"})
+
+	write := func() []byte {
+		var buf bytes.Buffer
+		if err := writeGoContext(&buf, "FROM scratch\n", binary); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	archive := write()
+	want := map[string]string{"Dockerfile": "FROM scratch\n", "app": "\x7fELF binary"}
+	if got := readTar(t, bytes.NewReader(archive)); !reflect.DeepEqual(got, want) {
+		t.Errorf("writeGoContext() archived %q, want %q", got, want)
+	}
+
+	// the same binary gives the same archive
+	if err := os.Chmod(binary, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(write(), archive) {
+		t.Error("writeGoContext() of the same binary gave a different archive")
+	}
+
+	if err := writeGoContext(ioutil.Discard, "FROM scratch\n", filepath.Join(dir, "missing")); err == nil {
+		t.Error("writeGoContext() of a missing binary succeeded")
+	}
+}
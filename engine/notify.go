@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/radovskyb/watcher"
+)
+
+// watchLimitError is returned when the system runs out of inotify watches
+// or instances
+type watchLimitError struct {
+	err error
+}
+
+func (e watchLimitError) Error() string {
+	return "inotify limit reached: " + e.err.Error()
+}
+
+func notifyError(err error) error {
+	if err == syscall.ENOSPC || err == syscall.EMFILE {
+		return watchLimitError{err}
+	}
+	return err
+}
+
+// notifier turns fsnotify events into file events, watching every directory
+// below the watch path which is not ignored
+type notifier struct {
+	watcher *fsnotify.Watcher
+	ignored IgnoreFn
+	// directories being watched
+	dirs map[string]bool
+}
+
+// notifyFiles sends the changes below watchPath to events as the system
+// reports them, watching new directories as they appear, until ctx is
+// cancelled
+func notifyFiles(ctx context.Context, watchPath string, ignored IgnoreFn, events chan<- fileEvent) error {
+	// paths are absolute, like the polling watcher reports them
+	watchPath, err := filepath.Abs(watchPath)
+	if err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return notifyError(err)
+	}
+	defer w.Close()
+
+	n := &notifier{watcher: w, ignored: ignored, dirs: make(map[string]bool)}
+	if err := n.addDir(watchPath, nil); err != nil {
+		return err
+	}
+	log.Printf("Watching %d directories below %s for changes", len(n.dirs), watchPath)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-w.Errors:
+			if err != fsnotify.ErrEventOverflow {
+				return notifyError(err)
+			}
+			// changes were dropped, so rebuild as if something changed
+			log.Printf("Too many changes below %s to tell them apart", watchPath)
+			select {
+			case events <- fileEvent{Op: watcher.Write, Path: watchPath, IsDir: true}:
+			case <-ctx.Done():
+			}
+		case event := <-w.Events:
+			changes, err := n.changes(event)
+			if err != nil {
+				return err
+			}
+			for _, change := range changes {
+				select {
+				case events <- change:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// changes returns the file events of an fsnotify event
+func (n *notifier) changes(event fsnotify.Event) ([]fileEvent, error) {
+	path := event.Name
+	// hidden files are ignored like the polling watcher does
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return nil, nil
+	}
+
+	switch {
+	case event.Op&fsnotify.Create != 0:
+		info, err := os.Lstat(path)
+		if err != nil {
+			// removed again already
+			return nil, nil
+		}
+		if !info.IsDir() {
+			return []fileEvent{{Op: watcher.Create, Path: path}}, nil
+		}
+		// files may have been created in the directory before it was watched
+		changes := []fileEvent{{Op: watcher.Create, Path: path, IsDir: true}}
+		if err := n.addDir(path, &changes); err != nil {
+			return nil, err
+		}
+		return changes, nil
+	case event.Op&fsnotify.Remove != 0:
+		return []fileEvent{{Op: watcher.Remove, Path: path, IsDir: n.removeDir(path)}}, nil
+	case event.Op&fsnotify.Rename != 0:
+		// the new name comes as a create event
+		return []fileEvent{{Op: watcher.Rename, Path: path, IsDir: n.removeDir(path)}}, nil
+	case event.Op&fsnotify.Write != 0:
+		return []fileEvent{{Op: watcher.Write, Path: path}}, nil
+	case event.Op&fsnotify.Chmod != 0:
+		return []fileEvent{{Op: watcher.Chmod, Path: path, IsDir: n.dirs[path]}}, nil
+	}
+	return nil, nil
+}
+
+// addDir watches a directory and the directories below it which are not
+// ignored or hidden, appending create events for what it finds to created
+func (n *notifier) addDir(dir string, created *[]fileEvent) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path != dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path != dir {
+			if strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if created != nil {
+				*created = append(*created, fileEvent{Op: watcher.Create, Path: path, IsDir: info.IsDir()})
+			}
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if n.ignored(path, true) {
+			return filepath.SkipDir
+		}
+		if err := n.watcher.Add(path); err != nil {
+			return notifyError(err)
+		}
+		n.dirs[path] = true
+		return nil
+	})
+}
+
+// removeDir stops watching a directory which was removed or renamed, and the
+// directories below it, and reports if it was a directory
+func (n *notifier) removeDir(dir string) bool {
+	if !n.dirs[dir] {
+		return false
+	}
+	prefix := dir + string(filepath.Separator)
+	for path := range n.dirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			// the system may have dropped the watch already
+			n.watcher.Remove(path)
+			delete(n.dirs, path)
+		}
+	}
+	return true
+}
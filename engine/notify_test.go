@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/radovskyb/watcher"
+)
+
+func TestNotifyError(t *testing.T) {
+	other := errors.New("bad file descriptor")
+	tests := []struct {
+		err   error
+		limit bool
+	}{
+		{syscall.ENOSPC, true},
+		{syscall.EMFILE, true},
+		{syscall.EACCES, false},
+		{other, false},
+	}
+	for _, test := range tests {
+		err := notifyError(test.err)
+		if _, limit := err.(watchLimitError); limit != test.limit {
+			t.Errorf("notifyError(%v) = %#v, want a watchLimitError %v", test.err, err, test.limit)
+		}
+		if !test.limit && err != test.err {
+			t.Errorf("notifyError(%v) = %v, want it unchanged", test.err, err)
+		}
+	}
+}
+
+func TestNotifierChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"main.go":             "package main\n",
+		"lib/lib.go":          "package lib\n",
+		"node_modules/a/a.js": "\n",
+		".git/HEAD":           "ref: refs/heads/master\n",
+	})
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	n := &notifier{
+		watcher: w,
+		ignored: func(path string, isDir bool) bool { return filepath.Base(path) == "node_modules" },
+		dirs:    make(map[string]bool),
+	}
+	path := func(rel string) string { return filepath.Join(dir, filepath.FromSlash(rel)) }
+	watched := func() []string {
+		var dirs []string
+		for d := range n.dirs {
+			rel, _ := filepath.Rel(dir, d)
+			dirs = append(dirs, filepath.ToSlash(rel))
+		}
+		sort.Strings(dirs)
+		return dirs
+	}
+
+	if err := n.addDir(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	// ignored and hidden directories are not watched
+	if got, want := watched(), []string{".", "lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("addDir() watched %q, want %q", got, want)
+	}
+
+	// a new directory is watched along with what was created in it
+	writeFiles(t, dir, map[string]string{"api/v1/api.go": "package v1\n"})
+	writeFiles(t, dir, map[string]string{"new.go": "package main\n"})
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  []fileEvent
+	}{
+		{
+			name:  "write",
+			event: fsnotify.Event{Name: path("main.go"), Op: fsnotify.Write},
+			want:  []fileEvent{{Op: watcher.Write, Path: path("main.go")}},
+		},
+		{
+			name:  "create file",
+			event: fsnotify.Event{Name: path("new.go"), Op: fsnotify.Create},
+			want:  []fileEvent{{Op: watcher.Create, Path: path("new.go")}},
+		},
+		{
+			name:  "create directory",
+			event: fsnotify.Event{Name: path("api"), Op: fsnotify.Create},
+			want: []fileEvent{
+				{Op: watcher.Create, Path: path("api"), IsDir: true},
+				{Op: watcher.Create, Path: path("api/v1"), IsDir: true},
+				{Op: watcher.Create, Path: path("api/v1/api.go")},
+			},
+		},
+		{
+			name:  "created and removed again",
+			event: fsnotify.Event{Name: path("gone.go"), Op: fsnotify.Create},
+		},
+		{
+			name:  "hidden",
+			event: fsnotify.Event{Name: path(".main.go.swp"), Op: fsnotify.Write},
+		},
+		{
+			name:  "chmod directory",
+			event: fsnotify.Event{Name: path("lib"), Op: fsnotify.Chmod},
+			want:  []fileEvent{{Op: watcher.Chmod, Path: path("lib"), IsDir: true}},
+		},
+		{
+			name:  "rename file",
+			event: fsnotify.Event{Name: path("main.go"), Op: fsnotify.Rename},
+			want:  []fileEvent{{Op: watcher.Rename, Path: path("main.go")}},
+		},
+		{
+			name:  "remove directory",
+			event: fsnotify.Event{Name: path("api"), Op: fsnotify.Remove},
+			want:  []fileEvent{{Op: watcher.Remove, Path: path("api"), IsDir: true}},
+		},
+		{
+			name:  "remove file",
+			event: fsnotify.Event{Name: path("lib/lib.go"), Op: fsnotify.Remove},
+			want:  []fileEvent{{Op: watcher.Remove, Path: path("lib/lib.go")}},
+		},
+	}
+	for _, test := range tests {
+		got, err := n.changes(test.event)
+		if err != nil {
+			t.Errorf("%s: changes() error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: changes() = %+v, want %+v", test.name, got, test.want)
+		}
+		if test.name == "create directory" {
+			if got, want := watched(), []string{".", "api", "api/v1", "lib"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("after creating a directory %q are watched, want %q", got, want)
+			}
+		}
+	}
+	// removing a directory stops watching the directories below it
+	if got, want := watched(), []string{".", "lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing a directory %q are watched, want %q", got, want)
+	}
+}
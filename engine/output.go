@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// buildMessage is a JSON message of the docker build output stream
+type buildMessage struct {
+	// Output of the build steps, which may end part way through a line
+	Stream string `json:"stream"`
+	// Progress of pulling base images, by layer ID
+	Status string `json:"status"`
+	ID     string `json:"id"`
+	// Set when the build failed
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	// Extra data, such as the ID of the built image
+	Aux json.RawMessage `json:"aux"`
+}
+
+var (
+	stepColor   = color.New(color.FgCyan, color.Bold)
+	streamColor = color.New(color.FgCyan)
+)
+
+// readBuildOutput prints the docker build output stream of an image step by
+// step, each line starting with prefix, and returns the ID of the built image.
+// A failed build is returned as an error. With verbose the raw messages are
+// printed too.
+func readBuildOutput(r io.Reader, out io.Writer, prefix string, verbose bool) (string, error) {
+	decoder := json.NewDecoder(r)
+	imageID := ""
+	// status last printed for each layer being pulled
+	statuses := make(map[string]string)
+	// output of the current line which has not ended yet
+	partial := ""
+
+	printLine := func(line string) {
+		if strings.HasPrefix(line, "Step ") {
+			stepColor.Fprintln(out, prefix+line)
+		} else {
+			streamColor.Fprintln(out, prefix+line)
+		}
+	}
+
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("unable to read image build response: %v", err)
+		}
+		if verbose {
+			fmt.Fprintln(out, prefix+string(raw))
+		}
+		var msg buildMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return "", fmt.Errorf("unable to read image build response: %v", err)
+		}
+
+		switch {
+		case msg.ErrorDetail != nil || msg.Error != "":
+			message := msg.Error
+			if msg.ErrorDetail != nil && msg.ErrorDetail.Message != "" {
+				message = msg.ErrorDetail.Message
+			}
+			if partial != "" {
+				printLine(partial)
+			}
+			return "", fmt.Errorf("docker build failed: %s", strings.TrimSpace(message))
+		case msg.Aux != nil:
+			var aux struct {
+				ID string `json:"ID"`
+			}
+			if json.Unmarshal(msg.Aux, &aux) == nil && aux.ID != "" {
+				imageID = aux.ID
+			}
+		case msg.Stream != "":
+			lines := strings.Split(partial+msg.Stream, "\n")
+			for _, line := range lines[:len(lines)-1] {
+				printLine(line)
+			}
+			partial = lines[len(lines)-1]
+		case msg.Status != "":
+			// progress bars are left out, only changes of status are printed
+			if statuses[msg.ID] == msg.Status {
+				continue
+			}
+			statuses[msg.ID] = msg.Status
+			if msg.ID != "" {
+				streamColor.Fprintf(out, "%s%s: %s\n", prefix, msg.ID, msg.Status)
+			} else {
+				streamColor.Fprintln(out, prefix+msg.Status)
+			}
+		}
+	}
+	if partial != "" {
+		printLine(partial)
+	}
+	return imageID, nil
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestReadBuildOutput(t *testing.T) {
+	color.NoColor = true
+	tests := []struct {
+		name    string
+		output  string
+		verbose bool
+		wantID  string
+		wantOut string
+		wantErr string
+	}{
+		{
+			name: "steps",
+			output: `{"stream":"Step 1/2 : FROM alpine\n"}
+{"stream":" ---> 196d12cf6ab1\n"}
+{"stream":"Step 2/2 : RUN true\n"}
+{"aux":{"ID":"sha256:5b0f"}}
+{"stream":"Successfully built 5b0f\n"}`,
+			wantID:  "sha256:5b0f",
+			wantOut: "app | Step 1/2 : FROM alpine\napp |  ---> 196d12cf6ab1\napp | Step 2/2 : RUN true\napp | Successfully built 5b0f\n",
+		},
+		{
+			name:    "lines split across messages",
+			output:  `{"stream":"compiling"}{"stream":" main.go\ndone"}{"stream":"\n"}{"stream":"no newline"}`,
+			wantOut: "app | compiling main.go\napp | done\napp | no newline\n",
+		},
+		{
+			name: "pull status changes",
+			output: `{"status":"Pulling from library/alpine","id":"latest"}
+{"status":"Downloading","id":"a1b2","progress":"[=>  ]"}
+{"status":"Downloading","id":"a1b2","progress":"[==> ]"}
+{"status":"Pull complete","id":"a1b2"}
+{"status":"Digest: sha256:c0ff"}`,
+			wantOut: "app | latest: Pulling from library/alpine\napp | a1b2: Downloading\napp | a1b2: Pull complete\napp | Digest: sha256:c0ff\n",
+		},
+		{
+			name: "error detail",
+			output: `{"stream":"Step 1/1 : RUN false"}
+{"errorDetail":{"code":1,"message":"The command '/bin/sh -c false' returned a non-zero code: 1"},"error":"returned a non-zero code"}`,
+			wantOut: "app | Step 1/1 : RUN false\n",
+			wantErr: "docker build failed: The command '/bin/sh -c false' returned a non-zero code: 1",
+		},
+		{
+			name:    "error",
+			output:  `{"error":"pull access denied\n"}`,
+			wantErr: "docker build failed: pull access denied",
+		},
+		{
+			name:    "verbose",
+			output:  `{"stream":"ok\n"}`,
+			verbose: true,
+			wantOut: "app | {\"stream\":\"ok\\n\"}\napp | ok\n",
+		},
+		{
+			name:    "invalid JSON",
+			output:  `{"stream":"ok\n"} not json`,
+			wantOut: "app | ok\n",
+			wantErr: "unable to read image build response",
+		},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		id, err := readBuildOutput(strings.NewReader(test.output), &out, "app | ", test.verbose)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: readBuildOutput() error = %v, want %q", test.name, err, test.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: readBuildOutput() error = %v", test.name, err)
+		}
+		if id != test.wantID {
+			t.Errorf("%s: readBuildOutput() = %q, want %q", test.name, id, test.wantID)
+		}
+		if out.String() != test.wantOut {
+			t.Errorf("%s: readBuildOutput() printed %q, want %q", test.name, out.String(), test.wantOut)
+		}
+	}
+}
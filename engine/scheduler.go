@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Images built at the same time unless build.concurrency is set
+const defaultBuildConcurrency = 2
+
+// scheduler limits how many images are built at the same time and cancels
+// the build of an image when a newer change to it supersedes the build
+type scheduler struct {
+	slots chan struct{}
+
+	mu sync.Mutex
+	// latest build of each image, by chart and image value
+	latest map[string]*scheduledBuild
+}
+
+type scheduledBuild struct {
+	cancel context.CancelFunc
+	// closed once this build and every build of the image before it finished
+	done chan struct{}
+}
+
+func newScheduler(concurrency int) *scheduler {
+	if concurrency <= 0 {
+		concurrency = defaultBuildConcurrency
+	}
+	return &scheduler{
+		slots:  make(chan struct{}, concurrency),
+		latest: make(map[string]*scheduledBuild),
+	}
+}
+
+// start a build of an image, cancelling the build before it. It waits until
+// every earlier build of the image finished so builds and deploys of an image
+// never overlap, unless ctx is cancelled. Call done once the build is deployed.
+func (s *scheduler) start(ctx context.Context, key string, name string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	build := &scheduledBuild{cancel: cancel, done: make(chan struct{})}
+
+	s.mu.Lock()
+	previous := s.latest[key]
+	s.latest[key] = build
+	s.mu.Unlock()
+
+	if previous != nil {
+		select {
+		case <-previous.done:
+		default:
+			log.Printf("Cancelling build of %s, a newer change supersedes it", name)
+			previous.cancel()
+			select {
+			case <-previous.done:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	return ctx, func() {
+		cancel()
+		s.mu.Lock()
+		if s.latest[key] == build {
+			delete(s.latest, key)
+		}
+		s.mu.Unlock()
+		// a build superseded while waiting may finish before the build it waited for
+		if previous == nil {
+			close(build.done)
+			return
+		}
+		go func() {
+			<-previous.done
+			close(build.done)
+		}()
+	}
+}
+
+// slot waits for a build slot, queueing when every slot is in use. Call
+// release once the image is built.
+func (s *scheduler) slot(ctx context.Context, name string) (func(), error) {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		log.Printf("Queued build of %s until a running build finishes", name)
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-s.slots }, nil
+}
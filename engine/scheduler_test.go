@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// returned reports if ch is closed within a short time
+func returned(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+func TestSchedulerSlot(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 3} {
+		s := newScheduler(concurrency)
+		want := concurrency
+		if want == 0 {
+			want = defaultBuildConcurrency
+		}
+
+		var mu sync.Mutex
+		running, most := 0, 0
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := s.slot(context.Background(), "goku/app1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				running++
+				if running > most {
+					most = running
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				release()
+			}()
+		}
+		wg.Wait()
+		if most != want {
+			t.Errorf("with concurrency %d %d builds ran at the same time, want %d", concurrency, most, want)
+		}
+	}
+}
+
+func TestSchedulerSlotCancelled(t *testing.T) {
+	s := newScheduler(1)
+	release, err := s.slot(context.Background(), "goku/app1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.slot(ctx, "goku/app2"); err != context.DeadlineExceeded {
+		t.Errorf("slot() while every slot is in use = %v, want %v", err, context.DeadlineExceeded)
+	}
+	release()
+	if release, err := s.slot(context.Background(), "goku/app2"); err != nil {
+		t.Errorf("slot() after a release = %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestSchedulerStart(t *testing.T) {
+	s := newScheduler(1)
+	bg := context.Background()
+	ctx1, done1 := s.start(bg, "app/image", "goku/app1")
+
+	// a newer change cancels the running build and waits for it
+	started2 := make(chan struct{})
+	var ctx2 context.Context
+	var done2 func()
+	go func() {
+		ctx2, done2 = s.start(bg, "app/image", "goku/app1")
+		close(started2)
+	}()
+	select {
+	case <-ctx1.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the first build was not cancelled")
+	}
+	if returned(started2) {
+		t.Fatal("the second build started before the first finished")
+	}
+
+	// builds of other images don't wait
+	ctxOther, doneOther := s.start(bg, "other/image", "goku/other")
+	if ctxOther.Err() != nil {
+		t.Errorf("build of another image was cancelled: %v", ctxOther.Err())
+	}
+	doneOther()
+
+	// a third change cancels the waiting build, and still waits for the first
+	started3 := make(chan struct{})
+	var ctx3 context.Context
+	var done3 func()
+	go func() {
+		ctx3, done3 = s.start(bg, "app/image", "goku/app1")
+		close(started3)
+	}()
+	if !returned(started2) {
+		t.Fatal("the waiting second build was not cancelled by the third")
+	}
+	if ctx2.Err() == nil {
+		t.Error("the second build was not cancelled")
+	}
+	done2()
+	if returned(started3) {
+		t.Fatal("the third build started before the first finished")
+	}
+
+	done1()
+	if !returned(started3) {
+		t.Fatal("the third build did not start once the first finished")
+	}
+	if ctx3.Err() != nil {
+		t.Errorf("the latest build was cancelled: %v", ctx3.Err())
+	}
+	done3()
+
+	// once every build finished the next starts right away
+	ctx4, done4 := s.start(bg, "app/image", "goku/app1")
+	if ctx4.Err() != nil {
+		t.Errorf("build after every build finished was cancelled: %v", ctx4.Err())
+	}
+	done4()
+}
+
+func TestSchedulerStartCancelled(t *testing.T) {
+	s := newScheduler(1)
+	_, done1 := s.start(context.Background(), "app/image", "goku/app1")
+	defer done1()
+
+	// stopping goku stops waiting for the previous build
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		ctx2, done2 := s.start(ctx, "app/image", "goku/app1")
+		if ctx2.Err() == nil {
+			t.Error("build started after stopping was not cancelled")
+		}
+		done2()
+		close(started)
+	}()
+	if returned(started) {
+		t.Fatal("the second build started before the first finished")
+	}
+	cancel()
+	if !returned(started) {
+		t.Error("start() kept waiting after ctx was cancelled")
+	}
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/timatooth/goku/config"
+)
+
+// tags docker accepts
+var validTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// tag an image is built with according to its tagPolicy, or the build
+// tagPolicy. key is the build cache key of the image.
+func (e *Engine) tag(ctx context.Context, image config.Image, contextPath string, key string) (string, error) {
+	policy := e.tagPolicy(image)
+	now := time.Now()
+	data := config.TagData{
+		Name:        image.Name,
+		Timestamp:   fmt.Sprintf("%d.%09d", now.Unix(), now.Nanosecond()),
+		Time:        now,
+		ContentHash: strings.TrimPrefix(key, "sha256:")[:12],
+	}
+	template := strings.Contains(policy, "{{")
+	if policy == config.TagGitCommit || (template && strings.Contains(policy, ".Git")) {
+		commit, dirty, err := gitCommit(ctx, contextPath)
+		if err != nil {
+			return "", err
+		}
+		data.GitCommit, data.GitDirty = commit, dirty
+	}
+
+	var tag string
+	switch {
+	case policy == config.TagGitCommit:
+		tag = data.GitCommit
+		if data.GitDirty {
+			// uncommitted changes need a new tag for Helm to roll out each build
+			tag += "-dirty-" + data.ContentHash[:7]
+		}
+	case policy == config.TagContentHash:
+		tag = data.ContentHash
+	case template:
+		tmpl, err := config.ParseTagTemplate(policy)
+		if err != nil {
+			return "", fmt.Errorf("invalid tagPolicy: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("invalid tagPolicy: %v", err)
+		}
+		tag = buf.String()
+	default:
+		tag = data.Timestamp
+	}
+	if !validTag.MatchString(tag) {
+		return "", fmt.Errorf("tagPolicy %q gave the invalid image tag %q", policy, tag)
+	}
+	return tag, nil
+}
+
+// tagPolicy of an image, which defaults to the build tagPolicy
+func (e *Engine) tagPolicy(image config.Image) string {
+	if image.TagPolicy != "" {
+		return image.TagPolicy
+	}
+	return e.Config.Build.TagPolicy
+}
+
+// gitCommit returns the short commit SHA checked out in dir and if dir has
+// uncommitted changes
+func gitCommit(ctx context.Context, dir string) (string, bool, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("could not get the git commit of %s: %v", dir, err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	status, err := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain", "--", ".").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("could not get the git status of %s: %v", dir, err)
+	}
+	return commit, len(bytes.TrimSpace(status)) > 0, nil
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/timatooth/goku/config"
+)
+
+const testKey = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestTag(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    string
+		pattern string
+		wantErr string
+	}{
+		{policy: "", pattern: `^\d+\.\d{9}$`},
+		{policy: config.TagTimestamp, pattern: `^\d+\.\d{9}$`},
+		{policy: config.TagContentHash, want: "0123456789ab"},
+		{policy: "dev-{{.ContentHash}}", want: "dev-0123456789ab"},
+		{policy: "{{.Name}}", wantErr: `tagPolicy "{{.Name}}" gave the invalid image tag "goku/app1"`},
+		{policy: "{{.Missing}}", wantErr: "invalid tagPolicy"},
+	}
+	for _, test := range tests {
+		e := New(&config.GokuConfig{Build: config.BuildConfig{TagPolicy: test.policy}})
+		got, err := e.tag(context.Background(), config.Image{Name: "goku/app1"}, ".", testKey)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("tag() with tagPolicy %q error = %v, want %q", test.policy, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tag() with tagPolicy %q error = %v", test.policy, err)
+			continue
+		}
+		if test.want != "" && got != test.want {
+			t.Errorf("tag() with tagPolicy %q = %q, want %q", test.policy, got, test.want)
+		}
+		if test.pattern != "" && !regexp.MustCompile(test.pattern).MatchString(got) {
+			t.Errorf("tag() with tagPolicy %q = %q, want it to match %s", test.policy, got, test.pattern)
+		}
+	}
+}
+
+func TestTagPolicy(t *testing.T) {
+	e := New(&config.GokuConfig{Build: config.BuildConfig{TagPolicy: config.TagGitCommit}})
+	if got := e.tagPolicy(config.Image{}); got != config.TagGitCommit {
+		t.Errorf("tagPolicy() = %q, want the build tagPolicy %q", got, config.TagGitCommit)
+	}
+	if got := e.tagPolicy(config.Image{TagPolicy: config.TagContentHash}); got != config.TagContentHash {
+		t.Errorf("tagPolicy() = %q, want the image tagPolicy %q", got, config.TagContentHash)
+	}
+}
+
+func TestTagGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "goku-tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=goku", "-c", "user.email=goku@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	writeFiles(t, dir, map[string]string{"app/Dockerfile": "FROM alpine\n", "other/README": "other\n"})
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	commit := git("rev-parse", "--short", "HEAD")
+
+	tag := func(policy string) string {
+		e := New(&config.GokuConfig{})
+		got, err := e.tag(context.Background(), config.Image{Name: "goku/app1", TagPolicy: policy}, dir+"/app", testKey)
+		if err != nil {
+			t.Fatalf("tag() with tagPolicy %q error = %v", policy, err)
+		}
+		return got
+	}
+	if got := tag(config.TagGitCommit); got != commit {
+		t.Errorf("tag() of a clean context = %q, want %q", got, commit)
+	}
+	if got, want := tag("{{.GitCommit}}{{if .GitDirty}}-dirty{{end}}"), commit; got != want {
+		t.Errorf("tag() of a clean context with a template = %q, want %q", got, want)
+	}
+
+	// changes outside of the build context don't make it dirty
+	writeFiles(t, dir, map[string]string{"other/README": "changed\n"})
+	if got := tag(config.TagGitCommit); got != commit {
+		t.Errorf("tag() with changes outside of the context = %q, want %q", got, commit)
+	}
+	writeFiles(t, dir, map[string]string{"app/main.go": "package main\n"})
+	if got, want := tag(config.TagGitCommit), commit+"-dirty-0123456"; got != want {
+		t.Errorf("tag() of a dirty context = %q, want %q", got, want)
+	}
+	if got, want := tag("{{.GitCommit}}{{if .GitDirty}}-dirty{{end}}"), commit+"-dirty"; got != want {
+		t.Errorf("tag() of a dirty context with a template = %q, want %q", got, want)
+	}
+}
+
+func TestTagGitCommitOutsideRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := New(&config.GokuConfig{})
+	if _, err := e.tag(context.Background(), config.Image{TagPolicy: config.TagGitCommit}, dir, testKey); err == nil {
+		t.Error("tag() with the gitCommit policy outside of a git repository succeeded")
+	}
+	// the timestamp policy doesn't need git
+	if _, err := e.tag(context.Background(), config.Image{}, dir, testKey); err != nil {
+		t.Errorf("tag() outside of a git repository error = %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// Debounce window unless watch.debounce or the image's debounce is set
+const defaultDebounce = 300 * time.Millisecond
+
+// WatchChangeFn is called with the file changes of a burst once it settles
+type WatchChangeFn func(changes ChangeSet)
+
+// IgnoreFn reports if changes to a path are ignored. Directories are only
+// ignored when nothing below them can be watched.
+type IgnoreFn func(path string, isDir bool) bool
+
+// File watching modes of goku watch --watch-mode
+const (
+	// Events from the system, polling when its inotify limits are reached
+	WatchAuto = "auto"
+	// Events from the system only
+	WatchNotify = "notify"
+	// Check the files for changes every pollInterval
+	WatchPoll = "poll"
+)
+
+const pollInterval = 100 * time.Millisecond
+
+// fileEvent is a change to a watched path
+type fileEvent struct {
+	Op watcher.Op
+	// Absolute path, or "old -> new" for renames and moves found by polling
+	Path  string
+	IsDir bool
+}
+
+// watchFiles calls watchCallback with the changes below watchPath which are
+// not ignored, once no further change comes within debounce, until ctx is
+// cancelled or the watcher fails
+func (e *Engine) watchFiles(ctx context.Context, watchPath string, ignored IgnoreFn, debounce time.Duration, watchCallback WatchChangeFn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan fileEvent)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- e.sendChanges(ctx, watchPath, ignored, events)
+	}()
+
+	var changes ChangeSet
+	var settled <-chan time.Time
+	for {
+		select {
+		case event := <-events:
+			if eventIgnored(event, ignored) {
+				continue
+			}
+			changes.add(event)
+			settled = time.After(debounce)
+		case <-settled:
+			watchCallback(changes)
+			changes = ChangeSet{}
+			settled = nil
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// sendChanges sends the changes below watchPath to events the way the
+// WatchMode says until ctx is cancelled
+func (e *Engine) sendChanges(ctx context.Context, watchPath string, ignored IgnoreFn, events chan<- fileEvent) error {
+	switch e.WatchMode {
+	case WatchPoll:
+		return pollFiles(ctx, watchPath, ignored, events)
+	case WatchNotify:
+		err := notifyFiles(ctx, watchPath, ignored, events)
+		if _, ok := err.(watchLimitError); ok {
+			return fmt.Errorf("%v, raise fs.inotify.max_user_watches or use --watch-mode %s", err, WatchPoll)
+		}
+		return err
+	default:
+		err := notifyFiles(ctx, watchPath, ignored, events)
+		if _, ok := err.(watchLimitError); !ok {
+			return err
+		}
+		log.Printf("Polling %s for changes instead, %v", watchPath, err)
+		return pollFiles(ctx, watchPath, ignored, events)
+	}
+}
+
+// pollFiles sends the changes below watchPath to events, checking the files
+// every pollInterval, until ctx is cancelled
+func pollFiles(ctx context.Context, watchPath string, ignored IgnoreFn, events chan<- fileEvent) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := watcher.New()
+	w.IgnoreHiddenFiles(true)
+	if err := w.AddRecursive(watchPath); err != nil {
+		return err
+	}
+	var ignoredPaths []string
+	for path, f := range w.WatchedFiles() {
+		if ignored(path, f.IsDir()) {
+			ignoredPaths = append(ignoredPaths, path)
+		}
+	}
+	if err := w.Ignore(ignoredPaths...); err != nil {
+		return err
+	}
+	log.Println("Watching files for changes:")
+	for path, f := range w.WatchedFiles() {
+		log.Printf("%s: %s\n", path, f.Name())
+	}
+
+	// closed if the watcher fails to start
+	failed := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-failed:
+			return
+		}
+		// Close is a no-op until the watcher has started, so retry until it stops
+		for {
+			w.Close()
+			select {
+			case <-w.Closed:
+				return
+			case <-failed:
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case event := <-w.Event:
+				select {
+				case events <- fileEvent{Op: event.Op, Path: event.Path, IsDir: event.IsDir()}:
+				case <-ctx.Done():
+				}
+			case err := <-w.Error:
+				select {
+				case errs <- err:
+				default:
+				}
+				cancel()
+			case <-w.Closed:
+				return
+			case <-failed:
+				return
+			}
+		}
+	}()
+
+	if err := w.Start(pollInterval); err != nil {
+		close(failed)
+		return err
+	}
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// eventIgnored reports if every path of an event is ignored. Renames and
+// moves have a path of "old -> new".
+func eventIgnored(event fileEvent, ignored IgnoreFn) bool {
+	for _, path := range strings.Split(event.Path, " -> ") {
+		if !ignored(path, event.IsDir) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChangeSet is a burst of file changes collapsed into one rebuild
+type ChangeSet struct {
+	// change of each path, a created path stays created when written to
+	ops map[string]watcher.Op
+}
+
+func (c *ChangeSet) add(event fileEvent) {
+	if c.ops == nil {
+		c.ops = make(map[string]watcher.Op)
+	}
+	if op, ok := c.ops[event.Path]; ok && op == watcher.Create && event.Op == watcher.Write {
+		return
+	}
+	c.ops[event.Path] = event.Op
+}
+
+// Paths changed, sorted
+func (c ChangeSet) Paths() []string {
+	paths := make([]string, 0, len(c.ops))
+	for path := range c.ops {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// String summarizes the changes, such as "12 files changed, 3 created"
+func (c ChangeSet) String() string {
+	counts := make(map[string]int)
+	for _, op := range c.ops {
+		counts[changeVerb(op)]++
+	}
+	var summary []string
+	for _, verb := range []string{"changed", "created", "removed", "renamed", "moved"} {
+		if counts[verb] == 0 {
+			continue
+		}
+		if len(summary) == 0 {
+			noun := "files"
+			if counts[verb] == 1 {
+				noun = "file"
+			}
+			summary = append(summary, fmt.Sprintf("%d %s %s", counts[verb], noun, verb))
+		} else {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[verb], verb))
+		}
+	}
+	return strings.Join(summary, ", ")
+}
+
+func changeVerb(op watcher.Op) string {
+	switch op {
+	case watcher.Create:
+		return "created"
+	case watcher.Remove:
+		return "removed"
+	case watcher.Rename:
+		return "renamed"
+	case watcher.Move:
+		return "moved"
+	default:
+		return "changed"
+	}
+}
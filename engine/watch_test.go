@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/timatooth/goku/config"
+)
+
+func TestChangeSet(t *testing.T) {
+	event := func(op watcher.Op, path string) fileEvent {
+		return fileEvent{Op: op, Path: path}
+	}
+	tests := []struct {
+		name      string
+		events    []fileEvent
+		want      string
+		wantPaths []string
+	}{
+		{
+			name:      "one file",
+			events:    []fileEvent{event(watcher.Write, "main.go")},
+			want:      "1 file changed",
+			wantPaths: []string{"main.go"},
+		},
+		{
+			name: "writes to a file",
+			events: []fileEvent{
+				event(watcher.Write, "main.go"),
+				event(watcher.Write, "main.go"),
+				event(watcher.Chmod, "main.go"),
+			},
+			want:      "1 file changed",
+			wantPaths: []string{"main.go"},
+		},
+		{
+			name: "created and written",
+			events: []fileEvent{
+				event(watcher.Create, "new.go"),
+				event(watcher.Write, "new.go"),
+				event(watcher.Write, "main.go"),
+			},
+			want:      "1 file changed, 1 created",
+			wantPaths: []string{"main.go", "new.go"},
+		},
+		{
+			name: "every kind",
+			events: []fileEvent{
+				event(watcher.Write, "a.go"),
+				event(watcher.Write, "b.go"),
+				event(watcher.Create, "c.go"),
+				event(watcher.Remove, "d.go"),
+				event(watcher.Rename, "e.go -> f.go"),
+				event(watcher.Move, "g.go -> lib/g.go"),
+			},
+			want:      "2 files changed, 1 created, 1 removed, 1 renamed, 1 moved",
+			wantPaths: []string{"a.go", "b.go", "c.go", "d.go", "e.go -> f.go", "g.go -> lib/g.go"},
+		},
+		{
+			name:      "created files",
+			events:    []fileEvent{event(watcher.Create, "a.go"), event(watcher.Create, "b.go")},
+			want:      "2 files created",
+			wantPaths: []string{"a.go", "b.go"},
+		},
+		{
+			name:      "nothing",
+			wantPaths: []string{},
+		},
+	}
+	for _, test := range tests {
+		var changes ChangeSet
+		for _, event := range test.events {
+			changes.add(event)
+		}
+		if got := changes.String(); got != test.want {
+			t.Errorf("%s: String() = %q, want %q", test.name, got, test.want)
+		}
+		if got := changes.Paths(); !reflect.DeepEqual(got, test.wantPaths) {
+			t.Errorf("%s: Paths() = %q, want %q", test.name, got, test.wantPaths)
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	tests := []struct {
+		watch string
+		image string
+		want  time.Duration
+	}{
+		{"", "", defaultDebounce},
+		{"1s", "", time.Second},
+		{"1s", "50ms", 50 * time.Millisecond},
+		{"", "0s", 0},
+		{"", "soon", defaultDebounce},
+	}
+	for _, test := range tests {
+		e := New(&config.GokuConfig{Watch: config.WatchConfig{Debounce: test.watch}})
+		if got := e.debounce(config.Image{Debounce: test.image}); got != test.want {
+			t.Errorf("debounce() with watch %q and image %q = %v, want %v", test.watch, test.image, got, test.want)
+		}
+	}
+}
+
+func TestWatchFilesDebounce(t *testing.T) {
+	for _, mode := range []string{WatchPoll, WatchNotify} {
+		testWatchFilesDebounce(t, mode)
+	}
+}
+
+func testWatchFilesDebounce(t *testing.T, mode string) {
+	dir, err := ioutil.TempDir("", "goku-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n", "debug.log": "\n", "lib/a.go": "package lib\n"})
+
+	e := New(&config.GokuConfig{})
+	e.WatchMode = mode
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var bursts []ChangeSet
+	ignored := func(path string, isDir bool) bool { return filepath.Ext(path) == ".log" }
+	watching := make(chan error, 1)
+	go func() {
+		watching <- e.watchFiles(ctx, dir, ignored, 300*time.Millisecond, func(changes ChangeSet) {
+			mu.Lock()
+			defer mu.Unlock()
+			bursts = append(bursts, changes)
+		})
+	}()
+	// the polling watcher takes its first snapshot when it starts
+	time.Sleep(200 * time.Millisecond)
+
+	// a burst of changes over several polls of the watcher
+	for i := 0; i < 3; i++ {
+		writeFiles(t, dir, map[string]string{
+			"main.go":   "package main // " + string('a'+rune(i)) + "\n",
+			"debug.log": "changed\n",
+			"lib/a.go":  "package lib // " + string('a'+rune(i)) + "\n",
+		})
+		time.Sleep(120 * time.Millisecond)
+	}
+	time.Sleep(700 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-watching:
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s: watchFiles() kept watching after ctx was cancelled", mode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bursts) != 1 {
+		t.Fatalf("%s: watchCallback was called %d times with %v, want once", mode, len(bursts), bursts)
+	}
+	want := []string{filepath.Join(dir, "lib", "a.go"), filepath.Join(dir, "main.go")}
+	if got := bursts[0].Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: watchCallback was called with %q, want %q", mode, got, want)
+	}
+}
+
+func TestEventIgnored(t *testing.T) {
+	ignored := func(path string, isDir bool) bool {
+		return filepath.Ext(path) == ".log" || (isDir && filepath.Base(path) == "tmp")
+	}
+	tests := []struct {
+		event fileEvent
+		want  bool
+	}{
+		{fileEvent{Op: watcher.Write, Path: "/app/main.go"}, false},
+		{fileEvent{Op: watcher.Write, Path: "/app/debug.log"}, true},
+		{fileEvent{Op: watcher.Create, Path: "/app/tmp", IsDir: true}, true},
+		{fileEvent{Op: watcher.Create, Path: "/app/tmp"}, false},
+		{fileEvent{Op: watcher.Rename, Path: "/app/a.log -> /app/b.log"}, true},
+		{fileEvent{Op: watcher.Rename, Path: "/app/debug.log -> /app/main.go"}, false},
+		{fileEvent{Op: watcher.Move, Path: "/app/main.go -> /app/old.log"}, false},
+	}
+	for _, test := range tests {
+		if got := eventIgnored(test.event, ignored); got != test.want {
+			t.Errorf("eventIgnored(%+v) = %v, want %v", test.event, got, test.want)
+		}
+	}
+}
+
+func TestPollFilesStops(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	notIgnored := func(path string, isDir bool) bool { return false }
+
+	// cancelled before the watcher started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- pollFiles(ctx, dir, notIgnored, make(chan fileEvent))
+	}()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("pollFiles() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pollFiles() kept polling after ctx was cancelled")
+	}
+
+	if err := pollFiles(context.Background(), filepath.Join(dir, "missing"), notIgnored, make(chan fileEvent)); err == nil {
+		t.Error("pollFiles() of a missing directory succeeded")
+	}
+}
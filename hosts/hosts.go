@@ -0,0 +1,158 @@
+// Package hosts keeps a clearly marked block of goku entries in the hosts
+// file, leaving every other entry untouched.
+package hosts
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	beginMarker = "# BEGIN goku managed hosts, changes inside this block are overwritten"
+	endMarker   = "# END goku managed hosts"
+)
+
+// DefaultPath of the hosts file on this OS
+func DefaultPath() string {
+	if runtime.GOOS == "windows" {
+		systemRoot := os.Getenv("SystemRoot")
+		if systemRoot == "" {
+			systemRoot = `C:\Windows`
+		}
+		return filepath.Join(systemRoot, "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// Update writes the goku block of the hosts file at path, mapping every
+// hostname to ip. It reports if the file had to be changed.
+func Update(path string, ip string, hostnames []string) (bool, error) {
+	lines := []string{beginMarker}
+	for _, hostname := range hostnames {
+		lines = append(lines, ip+" "+hostname)
+	}
+	lines = append(lines, endMarker)
+	return rewrite(path, lines)
+}
+
+// Clean removes the goku block from the hosts file at path. It reports if
+// there was a block to remove.
+func Clean(path string) (bool, error) {
+	return rewrite(path, nil)
+}
+
+// rewrite replaces the goku block with block, or removes it when block is nil
+func rewrite(path string, block []string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	content := string(data)
+
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case beginMarker:
+			begin = i
+		case endMarker:
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+
+	var out []string
+	switch {
+	case begin >= 0 && end >= 0:
+		out = append(out, lines[:begin]...)
+		out = append(out, block...)
+		out = append(out, lines[end+1:]...)
+	case begin >= 0:
+		return false, fmt.Errorf("%s has a goku block with no end marker %q, fix it by hand", path, endMarker)
+	case block == nil:
+		// nothing to clean, leave the file as it is
+		return false, nil
+	default:
+		out = append(out, lines...)
+		out = append(out, block...)
+	}
+
+	updated := strings.Join(out, "\n")
+	if len(out) > 0 {
+		updated += "\n"
+	}
+	if updated == content {
+		return false, nil
+	}
+	return true, writeAtomic(path, []byte(updated))
+}
+
+// writeAtomic replaces the file at path by renaming a complete copy over it
+func writeAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".hosts.goku")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Sync updates the goku block whenever the IP returned by clusterIP changes,
+// checking every interval until ctx is done or the hosts file can't be written.
+func Sync(ctx context.Context, path string, hostnames []string, clusterIP func() (string, error), interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastIP := ""
+	for {
+		ip, err := clusterIP()
+		if err != nil {
+			log.Printf("Could not get the cluster IP for %s: %v", path, err)
+		} else if ip != lastIP {
+			changed, err := Update(path, ip, hostnames)
+			if err != nil {
+				return err
+			}
+			if changed {
+				log.Printf("Pointed %s at %s in %s", strings.Join(hostnames, ", "), ip, path)
+			}
+			lastIP = ip
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package hosts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const block = beginMarker + "\n192.168.99.100 app1.goku.test\n192.168.99.100 app2.goku.test\n" + endMarker + "\n"
+
+func TestRewrite(t *testing.T) {
+	hostnames := []string{"app1.goku.test", "app2.goku.test"}
+	update := func(path string) (bool, error) { return Update(path, "192.168.99.100", hostnames) }
+	tests := []struct {
+		name    string
+		rewrite func(path string) (bool, error)
+		content string
+		want    string
+		changed bool
+		err     bool
+	}{
+		{
+			name:    "update without a block",
+			rewrite: update,
+			content: "127.0.0.1 localhost\n",
+			want:    "127.0.0.1 localhost\n" + block,
+			changed: true,
+		},
+		{
+			name:    "update without a trailing newline",
+			rewrite: update,
+			content: "127.0.0.1 localhost",
+			want:    "127.0.0.1 localhost\n" + block,
+			changed: true,
+		},
+		{
+			name:    "update an empty file",
+			rewrite: update,
+			content: "",
+			want:    block,
+			changed: true,
+		},
+		{
+			name:    "update an existing block",
+			rewrite: update,
+			content: "127.0.0.1 localhost\n" + beginMarker + "\n10.0.0.1 app1.goku.test\n" + endMarker + "\n::1 localhost\n",
+			want:    "127.0.0.1 localhost\n" + block + "::1 localhost\n",
+			changed: true,
+		},
+		{
+			name:    "update an up to date block",
+			rewrite: update,
+			content: "127.0.0.1 localhost\n" + block,
+			want:    "127.0.0.1 localhost\n" + block,
+		},
+		{
+			name:    "update a block without an end marker",
+			rewrite: update,
+			content: "127.0.0.1 localhost\n" + beginMarker + "\n10.0.0.1 app1.goku.test\n",
+			want:    "127.0.0.1 localhost\n" + beginMarker + "\n10.0.0.1 app1.goku.test\n",
+			err:     true,
+		},
+		{
+			name:    "clean an existing block",
+			rewrite: Clean,
+			content: "127.0.0.1 localhost\n" + block + "::1 localhost\n",
+			want:    "127.0.0.1 localhost\n::1 localhost\n",
+			changed: true,
+		},
+		{
+			name:    "clean a block at the end without a trailing newline",
+			rewrite: Clean,
+			content: "127.0.0.1 localhost\n" + block[:len(block)-1],
+			want:    "127.0.0.1 localhost\n",
+			changed: true,
+		},
+		{
+			name:    "clean without a block",
+			rewrite: Clean,
+			content: "127.0.0.1 localhost\n",
+			want:    "127.0.0.1 localhost\n",
+		},
+		{
+			name:    "clean without a block or a trailing newline",
+			rewrite: Clean,
+			content: "127.0.0.1 localhost",
+			want:    "127.0.0.1 localhost",
+		},
+		{
+			name:    "clean an empty file",
+			rewrite: Clean,
+			content: "",
+			want:    "",
+		},
+		{
+			name:    "clean a block without an end marker",
+			rewrite: Clean,
+			content: beginMarker + "\n10.0.0.1 app1.goku.test\n",
+			want:    beginMarker + "\n10.0.0.1 app1.goku.test\n",
+			err:     true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "goku-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts")
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		changed, err := test.rewrite(path)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.err)
+		}
+		if changed != test.changed {
+			t.Errorf("%s: changed = %v, want %v", test.name, changed, test.changed)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%s: hosts file is %q, want %q", test.name, data, test.want)
+		}
+	}
+}
+
+func TestRewriteKeepsMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0604); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Update(path, "192.168.99.100", []string{"app1.goku.test"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != 0604 {
+		t.Errorf("hosts file mode = %v, want %v", info.Mode(), os.FileMode(0604))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("rewriting left %d files behind", len(files)-1)
+	}
+}
+
+func TestUpdateMissingFile(t *testing.T) {
+	if _, err := Update(filepath.Join(os.TempDir(), "goku-no-such-hosts"), "192.168.99.100", nil); err == nil {
+		t.Error("Update() of a missing hosts file succeeded")
+	}
+}
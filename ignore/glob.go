@@ -0,0 +1,53 @@
+package ignore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// Globs matches paths against glob patterns such as *.pyc or build/**.
+// Patterns without a / match file and directory names at any depth, others
+// the whole path. * and ? don't match /, while ** does.
+type Globs struct {
+	globs []globPattern
+}
+
+type globPattern struct {
+	text string
+	glob glob.Glob
+	// match names rather than paths
+	name bool
+}
+
+// NewGlobs compiles glob patterns
+func NewGlobs(patterns []string) (*Globs, error) {
+	g := &Globs{}
+	for _, text := range patterns {
+		compiled, err := glob.Compile(text, '/')
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %v", text, err)
+		}
+		g.globs = append(g.globs, globPattern{text: text, glob: compiled, name: !strings.Contains(text, "/")})
+	}
+	return g, nil
+}
+
+// Match returns the pattern matching a relative path or one of its parent
+// directories, or "" when none does
+func (g *Globs) Match(relPath string) string {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+	for _, p := range g.globs {
+		for i := range segments {
+			if p.name && p.glob.Match(segments[i]) {
+				return p.text
+			}
+			if !p.name && p.glob.Match(strings.Join(segments[:i+1], "/")) {
+				return p.text
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package ignore
+
+import "testing"
+
+func TestGlobsMatch(t *testing.T) {
+	g, err := NewGlobs([]string{"*.pyc", "build/**", "docs/*.md", "tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.pyc", "*.pyc"},
+		{"app/lib/main.pyc", "*.pyc"},
+		{"build/out/app", "build/**"},
+		{"app/build/out", ""},
+		{"docs/index.md", "docs/*.md"},
+		{"docs/api/index.md", ""},
+		{"tmp", "tmp"},
+		{"app/tmp/cache", "tmp"},
+		{"main.py", ""},
+	}
+	for _, test := range tests {
+		if got := g.Match(test.path); got != test.want {
+			t.Errorf("Match(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestNewGlobsInvalid(t *testing.T) {
+	if _, err := NewGlobs([]string{"[a-"}); err == nil {
+		t.Error("NewGlobs accepted an invalid pattern")
+	}
+}
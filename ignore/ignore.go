@@ -0,0 +1,279 @@
+// Package ignore matches paths in a Docker build context against the
+// patterns of its .dockerignore file, the same way docker build does. It
+// also reads .gitignore files and matches glob patterns, which decide the
+// files goku watch ignores.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DockerignoreFile is the name of the file in the build context holding the patterns
+const DockerignoreFile = ".dockerignore"
+
+// Matcher decides which paths of a build context are excluded
+type Matcher struct {
+	patterns []*pattern
+}
+
+// Rule is the pattern which decided if a path is excluded
+type Rule struct {
+	// Pattern as written, starting with ! when it re-includes paths
+	Pattern string
+	// Ignore file the pattern was read from, if any
+	File string
+}
+
+type pattern struct {
+	rule Rule
+	text string
+	// ! patterns re-include paths excluded by the patterns before them
+	exclusion bool
+	re        *regexp.Regexp
+	// number of path segments the pattern has, to match it against parent directories
+	dirs int
+	// match the pattern against every parent directory, like git does
+	anyParent bool
+}
+
+// ReadDockerignore reads the .dockerignore file of a build context. A
+// context without one excludes nothing.
+func ReadDockerignore(contextDir string) (*Matcher, error) {
+	f, err := os.Open(filepath.Join(contextDir, DockerignoreFile))
+	if os.IsNotExist(err) {
+		return &Matcher{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := readPatterns(f, DockerignoreFile, "", dockerignorePattern, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", f.Name(), err)
+	}
+	return m, nil
+}
+
+// ignoreLine is a pattern of an ignore file and the line it was read from
+type ignoreLine struct {
+	pattern string
+	line    string
+}
+
+// parse reads the lines of an ignore file, converting each to a pattern.
+// Comments, blank lines and lines convert gives no pattern for are left out.
+func parse(r io.Reader, convert func(line string) string) ([]ignoreLine, error) {
+	var lines []ignoreLine
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if pattern := convert(line); pattern != "" {
+			lines = append(lines, ignoreLine{pattern: pattern, line: trimmed})
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// dockerignorePattern cleans a .dockerignore line into a pattern, or "" if
+// there is none
+func dockerignorePattern(line string) string {
+	line = strings.TrimSpace(line)
+	exclusion := strings.HasPrefix(line, "!")
+	if exclusion {
+		line = strings.TrimSpace(line[1:])
+	}
+	if line == "" {
+		return ""
+	}
+	line = filepath.ToSlash(filepath.Clean(line))
+	if len(line) > 1 && line[0] == '/' {
+		line = line[1:]
+	}
+	if exclusion {
+		line = "!" + line
+	}
+	return line
+}
+
+// readPatterns reads the lines of an ignore file into a Matcher, converting
+// each to a pattern relative to dir, a slash separated directory of the
+// paths matched
+func readPatterns(r io.Reader, file string, dir string, convert func(line string) string, anyParent bool) (*Matcher, error) {
+	lines, err := parse(r, convert)
+	if err != nil {
+		return nil, err
+	}
+	m := &Matcher{}
+	for _, line := range lines {
+		text := line.pattern
+		if dir != "" {
+			if strings.HasPrefix(text, "!") {
+				text = "!" + dir + "/" + text[1:]
+			} else {
+				text = dir + "/" + text
+			}
+		}
+		lineMatcher, err := New([]string{text})
+		if err != nil {
+			return nil, err
+		}
+		lineMatcher.patterns[0].rule = Rule{Pattern: line.line, File: file}
+		lineMatcher.patterns[0].anyParent = anyParent
+		m.patterns = append(m.patterns, lineMatcher.patterns...)
+	}
+	return m, nil
+}
+
+// New creates a Matcher from .dockerignore patterns. Later patterns take
+// precedence, so a pattern starting with ! re-includes paths excluded before it.
+func New(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, text := range patterns {
+		p := &pattern{text: text, rule: Rule{Pattern: text}}
+		if strings.HasPrefix(text, "!") {
+			p.exclusion = true
+			text = text[1:]
+		}
+		if text == "" {
+			return nil, fmt.Errorf("illegal exclusion pattern: %q", p.text)
+		}
+		re, err := regexp.Compile(patternRegexp(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p.text, err)
+		}
+		p.re = re
+		p.dirs = len(strings.Split(text, "/"))
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// Excludes reports if a path relative to the build context is left out of it.
+// A path is also excluded when one of its parent directories is.
+func (m *Matcher) Excludes(relPath string) bool {
+	excluded, _ := m.Match(relPath)
+	return excluded
+}
+
+// Match reports if a path relative to the build context is excluded and the
+// rule which decided it, which is empty when no pattern matches the path
+func (m *Matcher) Match(relPath string) (bool, Rule) {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	parentDirs := strings.Split(relPath, "/")
+	parentDirs = parentDirs[:len(parentDirs)-1]
+
+	excluded := false
+	var rule Rule
+	for _, p := range m.patterns {
+		match := p.re.MatchString(relPath)
+		if !match && p.anyParent {
+			for i := 1; i <= len(parentDirs) && !match; i++ {
+				match = p.re.MatchString(strings.Join(parentDirs[:i], "/"))
+			}
+		} else if !match && len(parentDirs) > 0 && p.dirs <= len(parentDirs) {
+			match = p.re.MatchString(strings.Join(parentDirs[:p.dirs], "/"))
+		}
+		if match {
+			excluded = !p.exclusion
+			rule = p.rule
+		}
+	}
+	return excluded, rule
+}
+
+// SkipDir reports if an excluded directory can be skipped entirely, which is
+// when no ! pattern could re-include something below it
+func (m *Matcher) SkipDir(relDir string) bool {
+	dirSlash := filepath.ToSlash(filepath.Clean(relDir)) + "/"
+	for _, p := range m.patterns {
+		if p.exclusion && strings.HasPrefix(p.text[1:]+"/", dirSlash) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keep re-includes paths, such as the Dockerfile, which docker build always
+// sends even if .dockerignore excludes them
+func (m *Matcher) Keep(relPaths ...string) *Matcher {
+	kept := &Matcher{patterns: append([]*pattern(nil), m.patterns...)}
+	for _, relPath := range relPaths {
+		relPath = filepath.ToSlash(filepath.Clean(relPath))
+		if !kept.Excludes(relPath) {
+			continue
+		}
+		keep, err := New([]string{"!" + relPath})
+		if err != nil {
+			continue
+		}
+		kept.patterns = append(kept.patterns, keep.patterns...)
+	}
+	return kept
+}
+
+// patternRegexp converts a pattern to a regular expression. * matches
+// anything but /, ? a single character other than /, ** any number of
+// directories and \ escapes the next character.
+func patternRegexp(text string) string {
+	var re bytes.Buffer
+	re.WriteString("^")
+	inClass := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+			re.WriteByte(c)
+		case c == '*':
+			if i+1 < len(text) && text[i+1] == '*' {
+				i++
+				// **/ is the same as **
+				if i+1 < len(text) && text[i+1] == '/' {
+					i++
+				}
+				if i+1 == len(text) {
+					re.WriteString(".*")
+				} else {
+					re.WriteString("(.*/)?")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			inClass = true
+			re.WriteByte(c)
+			if i+1 < len(text) && text[i+1] == '!' {
+				// negated class like filepath.Match
+				i++
+				re.WriteByte('^')
+			}
+		case c == '\\':
+			if i+1 < len(text) {
+				i++
+				re.WriteString(regexp.QuoteMeta(string(text[i])))
+			} else {
+				re.WriteString(`\\`)
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
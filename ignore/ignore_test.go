@@ -0,0 +1,195 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := "# comment\n\nnode_modules\n  *.log  \n!important.log\n/build/\n./tmp//cache\n!\n  # indented comment\n"
+	tests := []struct {
+		name    string
+		convert func(line string) string
+		want    []ignoreLine
+	}{
+		{"dockerignore", dockerignorePattern, []ignoreLine{
+			{"node_modules", "node_modules"},
+			{"*.log", "*.log"},
+			{"!important.log", "!important.log"},
+			{"build", "/build/"},
+			{"tmp/cache", "./tmp//cache"},
+		}},
+		{"gitignore", gitignorePattern, []ignoreLine{
+			{"**/node_modules", "node_modules"},
+			// git keeps leading spaces
+			{"**/  *.log", "*.log"},
+			{"!**/important.log", "!important.log"},
+			{"build", "/build/"},
+			{"./tmp//cache", "./tmp//cache"},
+		}},
+	}
+	for _, test := range tests {
+		lines, err := parse(strings.NewReader(data), test.convert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(lines, test.want) {
+			t.Errorf("%s: parse() = %q, want %q", test.name, lines, test.want)
+		}
+	}
+}
+
+func TestReadDockerignore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := ReadDockerignore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Excludes("app.log") {
+		t.Error("a context without a .dockerignore excludes app.log")
+	}
+
+	data := "# logs\n*.log\n!important.log\n/build/\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, DockerignoreFile), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = ReadDockerignore(dir); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+		rule Rule
+	}{
+		{"app.log", true, Rule{Pattern: "*.log", File: DockerignoreFile}},
+		{"important.log", false, Rule{Pattern: "!important.log", File: DockerignoreFile}},
+		{"build/app", true, Rule{Pattern: "/build/", File: DockerignoreFile}},
+		{"src/app.log", false, Rule{}},
+	}
+	for _, test := range tests {
+		excluded, rule := m.Match(test.path)
+		if excluded != test.want || rule != test.rule {
+			t.Errorf("Match(%q) = %v, %+v, want %v, %+v", test.path, excluded, rule, test.want, test.rule)
+		}
+	}
+}
+
+func TestMatcherExcludes(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{[]string{"*.log"}, "app.log", true},
+		{[]string{"*.log"}, "logs/app.log", false},
+		{[]string{"*/*.log"}, "logs/app.log", true},
+		{[]string{"**/*.log"}, "logs/2019/app.log", true},
+		{[]string{"**/*.log"}, "app.log", true},
+		{[]string{"build/**"}, "build/out/app", true},
+		{[]string{"node_modules"}, "node_modules/left-pad/index.js", true},
+		{[]string{"node_modules"}, "src/node_modules", false},
+		{[]string{"a?c"}, "abc", true},
+		{[]string{"a?c"}, "a/c", false},
+		{[]string{"[!a]*"}, "b.txt", true},
+		{[]string{"[!a]*"}, "a.txt", false},
+		{[]string{`\*.txt`}, "*.txt", true},
+		{[]string{`\*.txt`}, "a.txt", false},
+		{[]string{"*.md", "!Readme.md"}, "Readme.md", false},
+		{[]string{"*.md", "!Readme.md"}, "Changes.md", true},
+		{[]string{"!Readme.md", "*.md"}, "Readme.md", true},
+		{[]string{"docs", "!docs/index.md"}, "docs/index.md", false},
+		{[]string{"docs", "!docs/index.md"}, "docs/other.md", true},
+		{nil, "anything", false},
+	}
+	for _, test := range tests {
+		m, err := New(test.patterns)
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", test.patterns, err)
+		}
+		if got := m.Excludes(test.path); got != test.want {
+			t.Errorf("%q excludes %q = %v, want %v", test.patterns, test.path, got, test.want)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, patterns := range [][]string{{"!"}, {"[a-"}} {
+		if _, err := New(patterns); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", patterns)
+		}
+	}
+}
+
+func TestMatcherSkipDir(t *testing.T) {
+	m, err := New([]string{"docs", "!docs/index.md", "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{"docs", false},
+		{"build", true},
+		{"doc", true},
+	}
+	for _, test := range tests {
+		if got := m.SkipDir(test.dir); got != test.want {
+			t.Errorf("SkipDir(%q) = %v, want %v", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestMatcherKeep(t *testing.T) {
+	m, err := New([]string{"Dockerfile*", ".dockerignore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := m.Keep("Dockerfile.dev", ".dockerignore")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"Dockerfile.dev", false},
+		{".dockerignore", false},
+		{"Dockerfile", true},
+	}
+	for _, test := range tests {
+		if got := kept.Excludes(test.path); got != test.want {
+			t.Errorf("kept Excludes(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+	if !m.Excludes("Dockerfile.dev") {
+		t.Error("Keep modified the Matcher it was called on")
+	}
+}
+
+func TestMatcherMatchRule(t *testing.T) {
+	m, err := New([]string{"*.md", "!Readme.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		excluded bool
+		rule     string
+	}{
+		{"Changes.md", true, "*.md"},
+		{"Readme.md", false, "!Readme.md"},
+		{"main.go", false, ""},
+	}
+	for _, test := range tests {
+		excluded, rule := m.Match(test.path)
+		if excluded != test.excluded || rule.Pattern != test.rule {
+			t.Errorf("Match(%q) = %v, %q, want %v, %q", test.path, excluded, rule.Pattern, test.excluded, test.rule)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ignore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitignoreFile is the name of the files git reads ignore patterns from
+const GitignoreFile = ".gitignore"
+
+// ReadGitignores reads the .gitignore files in dir and the directories below
+// it into one Matcher of paths relative to dir. Patterns of deeper files take
+// precedence, and directory patterns like build/ also match files named build.
+func ReadGitignores(dir string) (*Matcher, error) {
+	return readTree(dir, GitignoreFile, gitignorePattern, true)
+}
+
+// ReadDockerignores reads the .dockerignore files in dir and the directories
+// below it into one Matcher of paths relative to dir. The patterns of each
+// file match paths relative to its own directory.
+func ReadDockerignores(dir string) (*Matcher, error) {
+	return readTree(dir, DockerignoreFile, dockerignorePattern, false)
+}
+
+// readTree reads the ignore files with a name in dir and below it. Hidden
+// directories and directories excluded by the files above them are skipped.
+func readTree(dir string, name string, convert func(line string) string, anyParent bool) (*Matcher, error) {
+	m := &Matcher{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path != dir {
+				// unreadable or removed while walking
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		} else if strings.HasPrefix(info.Name(), ".") || (m.Excludes(rel) && m.SkipDir(rel)) {
+			return filepath.SkipDir
+		}
+
+		file := filepath.Join(path, name)
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fileMatcher, err := readPatterns(f, filepath.ToSlash(filepath.Join(rel, name)), rel, convert, anyParent)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %v", file, err)
+		}
+		m.patterns = append(m.patterns, fileMatcher.patterns...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// gitignorePattern converts a .gitignore line into a pattern, or "" if there
+// is none. Patterns without a / other than a trailing one match at any depth.
+func gitignorePattern(line string) string {
+	// trailing spaces are left out unless escaped
+	trimmed := strings.TrimRight(line, " \t")
+	if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+		trimmed += " "
+	}
+	line = trimmed
+
+	exclusion := strings.HasPrefix(line, "!")
+	if exclusion {
+		line = line[1:]
+	}
+	line = strings.TrimSuffix(line, "/")
+	if line == "" {
+		return ""
+	}
+	if strings.HasPrefix(line, "/") {
+		line = line[1:]
+	} else if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	if exclusion {
+		line = "!" + line
+	}
+	return line
+}
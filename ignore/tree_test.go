@@ -0,0 +1,117 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitignorePattern(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"*.pyc", "**/*.pyc"},
+		{"build/", "**/build"},
+		{"/build", "build"},
+		{"docs/*.md", "docs/*.md"},
+		{"!keep.pyc", "!**/keep.pyc"},
+		{"!/build", "!build"},
+		{"name  ", "**/name"},
+		{`name\ `, `**/name\ `},
+		{"/", ""},
+		{"!", ""},
+	}
+	for _, test := range tests {
+		if got := gitignorePattern(test.line); got != test.want {
+			t.Errorf("gitignorePattern(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadGitignores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".gitignore":         "*.log\nbuild/\n/vendor\n",
+		"web/.gitignore":     "!keep.log\ndist\n",
+		"vendor/.gitignore":  "!*\n",
+		".hidden/.gitignore": "!*\n",
+		"web/src/.gitignore": "# only a comment\n",
+	})
+
+	m, err := ReadGitignores(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+		rule Rule
+	}{
+		{"app.log", true, Rule{Pattern: "*.log", File: ".gitignore"}},
+		{"api/app.log", true, Rule{Pattern: "*.log", File: ".gitignore"}},
+		{"web/keep.log", false, Rule{Pattern: "!keep.log", File: "web/.gitignore"}},
+		{"keep.log", true, Rule{Pattern: "*.log", File: ".gitignore"}},
+		{"web/dist/app.js", true, Rule{Pattern: "dist", File: "web/.gitignore"}},
+		{"dist/app.js", false, Rule{}},
+		{"api/build/out", true, Rule{Pattern: "build/", File: ".gitignore"}},
+		{"vendor/lib.go", true, Rule{Pattern: "/vendor", File: ".gitignore"}},
+		{"api/vendor/lib.go", false, Rule{}},
+		{"web/src/main.go", false, Rule{}},
+	}
+	for _, test := range tests {
+		excluded, rule := m.Match(test.path)
+		if excluded != test.want || rule != test.rule {
+			t.Errorf("Match(%q) = %v, %+v, want %v, %+v", test.path, excluded, rule, test.want, test.rule)
+		}
+	}
+}
+
+func TestReadDockerignores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goku-ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".dockerignore":     "*.log\n",
+		"web/.dockerignore": "*.log\nnode_modules\n",
+	})
+
+	m, err := ReadDockerignores(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"app.log", true},
+		{"api/app.log", false},
+		{"web/app.log", true},
+		{"web/node_modules/index.js", true},
+		{"node_modules/index.js", false},
+	}
+	for _, test := range tests {
+		if got := m.Excludes(test.path); got != test.want {
+			t.Errorf("Excludes(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}